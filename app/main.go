@@ -18,23 +18,50 @@ func main() {
 		}
 	}
 
-	commands := map[string]command.Command{
-		"exit":    command.ExitCommand{},
-		"echo":    command.EchoCommand{},
-		"pwd":     command.PwdCommand{},
-		"history": command.NewHistoryCommand(historyStore),
-	}
-
-	sh := shell.New(commands, historyStore)
-
-	commands["type"] = command.NewTypeCommand(sh.IsBuiltin, sh.IsExecutable)
-	commands["cd"] = command.NewCdCommand(sh.ChangeDir)
-
-	sh.Run()
-
-	if historyFile != "" {
+	sh := shell.New(builtins(historyStore), historyStore)
+	// the history is saved however the shell ends, SIGTERM and SIGHUP
+	// included
+	sh.OnExit(func() {
+		if historyFile == "" {
+			return
+		}
 		if err := historyStore.WriteTo(historyFile); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 		}
+	})
+
+	os.Exit(sh.Run())
+}
+
+// builtins returns the builtin commands bound to a shell. Every subshell
+// gets a set of its own, so that exit or cd there only affect the subshell.
+func builtins(historyStore *history.Store) func(*shell.Shell) map[string]command.Command {
+	return func(sh *shell.Shell) map[string]command.Command {
+		return map[string]command.Command{
+			"echo":     command.EchoCommand{},
+			"pwd":      command.NewPwdCommand(sh.Dir),
+			"history":  command.NewHistoryCommand(historyStore, sh.Path),
+			"type":     command.NewTypeCommand(sh.FunctionSource, sh.IsBuiltin, sh.IsExecutable),
+			"cd":       command.NewCdCommand(sh.ChangeDir),
+			"exec":     command.NewExecCommand(sh.Exec),
+			"exit":     command.NewExitCommand(sh.Status, sh.Exit),
+			"set":      command.NewSetCommand(sh.SetOption, sh.Options),
+			"break":    command.NewBreakCommand(sh.Break),
+			"continue": command.NewContinueCommand(sh.Continue),
+			"read":     command.NewReadCommand(sh.LookupVar, sh.SetVar),
+			"return":   command.NewReturnCommand(sh.Status, sh.Return),
+			"local":    command.NewLocalCommand(sh.Local, sh.SetVar),
+			"export":   command.NewExportCommand(sh.SetVar, sh.Export, sh.Variables),
+			"readonly": command.NewReadonlyCommand(sh.SetVar, sh.Readonly, sh.Variables),
+			"declare":  command.NewDeclareCommand(sh.SetVar, sh.Export, sh.Readonly, sh.Variables),
+			"unset":    command.NewUnsetCommand(sh.UnsetVar, sh.UnsetFunction),
+			"jobs":     command.NewJobsCommand(sh.Jobs),
+			"fg":       command.NewFgCommand(sh.LookupJob, sh.Foreground),
+			"bg":       command.NewBgCommand(sh.LookupJob, sh.Background),
+			"wait":     command.NewWaitCommand(sh.LookupJob, sh.Jobs, sh.WaitJob),
+			"disown":   command.NewDisownCommand(sh.LookupJob, sh.Disown),
+			"kill":     command.NewKillCommand(sh.LookupJob, sh.QueueSignal),
+			"trap":     command.NewTrapCommand(sh.SetTrap, sh.Traps),
+		}
 	}
 }
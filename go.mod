@@ -2,6 +2,7 @@ module github.com/codecrafters-io/shell-starter-go
 
 go 1.25.0
 
-require golang.org/x/term v0.38.0
-
-require golang.org/x/sys v0.39.0 // indirect
+require (
+	golang.org/x/sys v0.39.0
+	golang.org/x/term v0.38.0
+)
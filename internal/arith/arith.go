@@ -0,0 +1,188 @@
+package arith
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Variables is how bare identifiers in an expression reach shell variables.
+type Variables interface {
+	LookupVar(name string) (string, bool)
+	SetVar(name, value string) error
+}
+
+// maxDepth bounds how deep variables holding expressions may recurse.
+const maxDepth = 64
+
+// Eval evaluates expr with the C integer operators.
+func Eval(expr string, vars Variables) (int64, error) {
+	return eval(expr, vars, 0)
+}
+
+func eval(expr string, vars Variables, depth int) (int64, error) {
+	if depth > maxDepth {
+		return 0, fmt.Errorf("%s: expression recursion level exceeded", expr)
+	}
+
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return 0, err
+	}
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+
+	p := &parser{tokens: tokens, expr: expr}
+	n, err := p.parseComma()
+	if err != nil {
+		return 0, err
+	}
+	if !p.done() {
+		return 0, p.errorf("syntax error in expression")
+	}
+
+	e := &evaluator{vars: vars, depth: depth}
+	value, err := e.eval(n)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", strings.TrimSpace(expr), err)
+	}
+	return value, nil
+}
+
+/* =========================
+        TOKENIZER
+========================= */
+
+type tokenKind int
+
+const (
+	tokNumber tokenKind = iota
+	tokName
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  int64
+}
+
+// operators sorted so that longer ones are tried first
+var operators = []string{
+	"<<=", ">>=", "**",
+	"++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+=", "-=", "*=", "/=", "%=", "&=", "^=", "|=",
+	"+", "-", "*", "/", "%", "<", ">", "&", "^", "|", "!", "~",
+	"?", ":", "=", "(", ")", ",",
+}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		ch := expr[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			i++
+
+		case isDigit(ch):
+			j := i
+			for j < len(expr) && isNumberChar(expr[j]) {
+				j++
+			}
+			n, err := parseNumber(expr[i:j])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: expr[i:j], num: n})
+			i = j
+
+		case isAlpha(ch):
+			j := i
+			for j < len(expr) && (isAlpha(expr[j]) || isDigit(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokName, text: expr[i:j]})
+			i = j
+
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("%s: syntax error: invalid arithmetic operator (error token is \"%s\")", expr, expr[i:])
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// parseNumber accepts decimal, 0x hex, leading-0 octal and base#digits.
+func parseNumber(text string) (int64, error) {
+	base := 10
+	digits := text
+
+	if b, rest, ok := strings.Cut(text, "#"); ok {
+		n, err := strconv.Atoi(b)
+		if err != nil || n < 2 || n > 64 {
+			return 0, fmt.Errorf("%s: invalid arithmetic base", text)
+		}
+		base, digits = n, rest
+	} else if strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X") {
+		base, digits = 16, text[2:]
+	} else if len(text) > 1 && text[0] == '0' {
+		base, digits = 8, text[1:]
+	}
+
+	if digits == "" {
+		return 0, fmt.Errorf("%s: invalid number", text)
+	}
+
+	var n int64
+	for i := 0; i < len(digits); i++ {
+		d := digitValue(digits[i], base)
+		if d < 0 || d >= base {
+			return 0, fmt.Errorf("%s: value too great for base (error token is \"%s\")", text, text)
+		}
+		n = n*int64(base) + int64(d)
+	}
+	return n, nil
+}
+
+func digitValue(ch byte, base int) int {
+	switch {
+	case isDigit(ch):
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'z':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'Z':
+		// bases up to 36 are case-insensitive
+		if base <= 36 {
+			return int(ch-'A') + 10
+		}
+		return int(ch-'A') + 36
+	case ch == '@':
+		return 62
+	case ch == '_':
+		return 63
+	}
+	return -1
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func isAlpha(ch byte) bool {
+	return ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
+
+func isNumberChar(ch byte) bool {
+	return isAlpha(ch) || isDigit(ch) || ch == '@' || ch == '#'
+}
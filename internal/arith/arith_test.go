@@ -0,0 +1,88 @@
+package arith
+
+import (
+	"strings"
+	"testing"
+)
+
+type vars map[string]string
+
+func (v vars) LookupVar(name string) (string, bool) {
+	value, ok := v[name]
+	return value, ok
+}
+
+func (v vars) SetVar(name, value string) error {
+	v[name] = value
+	return nil
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want int64
+	}{
+		{"", 0},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"7 / 2", 3},
+		{"-7 / 2", -3},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 3", -8},
+		{"3 ** 0", 1},
+		{"2 ** 63", -9223372036854775808},
+		{"1 << 4 | 1", 17},
+		{"5 & 3 ^ 1", 0},
+		{"~0", -1},
+		{"!0 && !5", 0},
+		{"0 || 2", 1},
+		{"1 < 2 == 1", 1},
+		{"1 ? 2 : 3", 2},
+		{"0 ? 2 : 0 ? 3 : 4", 4},
+		{"0x1f + 010 + 2#101", 44},
+		{"x + 1", 5},
+		{"y * 2", 8},
+		{"unset + 1", 1},
+		{"x = 2, x += 3, x", 5},
+		{"x++ + x", 9},
+		{"--x", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := Eval(tt.expr, vars{"x": "4", "y": "x"})
+			if err != nil {
+				t.Fatalf("Eval(%q): %v", tt.expr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval(%q) = %d, want %d", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"1 / 0", "division by 0"},
+		{"1 % 0", "division by 0"},
+		{"2 ** -1", "exponent less than 0"},
+		{"1 +", "operand expected"},
+		{"(1", "missing `)'"},
+		{"1 ? 2", "`:' expected"},
+		{"08", "value too great for base"},
+		{"1 2", "syntax error in expression"},
+		{"a", "expression recursion level exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Eval(tt.expr, vars{"a": "a"})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Eval(%q) error = %v, want %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package arith
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* =========================
+        EVALUATOR
+========================= */
+
+type evaluator struct {
+	vars  Variables
+	depth int
+}
+
+func (e *evaluator) eval(n node) (int64, error) {
+	switch n := n.(type) {
+	case numberNode:
+		return n.value, nil
+
+	case varNode:
+		return e.lookup(n.name)
+
+	case unaryNode:
+		x, err := e.eval(n.x)
+		if err != nil {
+			return 0, err
+		}
+		switch n.op {
+		case "!":
+			return boolValue(x == 0), nil
+		case "~":
+			return ^x, nil
+		case "-":
+			return -x, nil
+		}
+		return x, nil
+
+	case incNode:
+		old, err := e.lookup(n.name)
+		if err != nil {
+			return 0, err
+		}
+		updated := old + 1
+		if n.op == "--" {
+			updated = old - 1
+		}
+		if err := e.assign(n.name, updated); err != nil {
+			return 0, err
+		}
+		if n.prefix {
+			return updated, nil
+		}
+		return old, nil
+
+	case binaryNode:
+		return e.evalBinary(n)
+
+	case assignNode:
+		value, err := e.eval(n.x)
+		if err != nil {
+			return 0, err
+		}
+		if n.op != "=" {
+			old, err := e.lookup(n.name)
+			if err != nil {
+				return 0, err
+			}
+			if value, err = apply(strings.TrimSuffix(n.op, "="), old, value); err != nil {
+				return 0, err
+			}
+		}
+		return value, e.assign(n.name, value)
+
+	case condNode:
+		cond, err := e.eval(n.cond)
+		if err != nil {
+			return 0, err
+		}
+		if cond != 0 {
+			return e.eval(n.then)
+		}
+		return e.eval(n.els)
+	}
+
+	return 0, fmt.Errorf("unknown expression node %T", n)
+}
+
+func (e *evaluator) evalBinary(n binaryNode) (int64, error) {
+	x, err := e.eval(n.x)
+	if err != nil {
+		return 0, err
+	}
+
+	// && and || only look at the right side when they have to
+	switch n.op {
+	case "&&":
+		if x == 0 {
+			return 0, nil
+		}
+		y, err := e.eval(n.y)
+		return boolValue(y != 0), err
+	case "||":
+		if x != 0 {
+			return 1, nil
+		}
+		y, err := e.eval(n.y)
+		return boolValue(y != 0), err
+	}
+
+	y, err := e.eval(n.y)
+	if err != nil {
+		return 0, err
+	}
+	return apply(n.op, x, y)
+}
+
+func apply(op string, x, y int64) (int64, error) {
+	switch op {
+	case ",":
+		return y, nil
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			return 0, errors.New("division by 0")
+		}
+		if op == "/" {
+			return x / y, nil
+		}
+		return x % y, nil
+	case "**":
+		if y < 0 {
+			return 0, errors.New("exponent less than 0")
+		}
+		// by squaring, so a huge exponent takes a few dozen steps
+		result := int64(1)
+		for ; y > 0; y >>= 1 {
+			if y&1 == 1 {
+				result *= x
+			}
+			x *= x
+		}
+		return result, nil
+	case "<<":
+		return x << uint64(y), nil
+	case ">>":
+		return x >> uint64(y), nil
+	case "<":
+		return boolValue(x < y), nil
+	case ">":
+		return boolValue(x > y), nil
+	case "<=":
+		return boolValue(x <= y), nil
+	case ">=":
+		return boolValue(x >= y), nil
+	case "==":
+		return boolValue(x == y), nil
+	case "!=":
+		return boolValue(x != y), nil
+	case "&":
+		return x & y, nil
+	case "^":
+		return x ^ y, nil
+	case "|":
+		return x | y, nil
+	}
+	return 0, fmt.Errorf("%s: unknown operator", op)
+}
+
+// lookup reads a variable as a number. A value that is not a plain number is
+// evaluated as an expression in turn, the way bash does.
+func (e *evaluator) lookup(name string) (int64, error) {
+	value, _ := e.vars.LookupVar(name)
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n, nil
+	}
+	return eval(value, e.vars, e.depth+1)
+}
+
+func (e *evaluator) assign(name string, value int64) error {
+	return e.vars.SetVar(name, strconv.FormatInt(value, 10))
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,253 @@
+package arith
+
+import "fmt"
+
+/* =========================
+         PARSER
+========================= */
+
+type node interface{}
+
+type numberNode struct {
+	value int64
+}
+
+type varNode struct {
+	name string
+}
+
+type unaryNode struct {
+	op string
+	x  node
+}
+
+// incNode is ++ or -- applied to a variable, before or after it.
+type incNode struct {
+	name   string
+	op     string
+	prefix bool
+}
+
+type binaryNode struct {
+	op   string
+	x, y node
+}
+
+type assignNode struct {
+	name string
+	op   string
+	x    node
+}
+
+type condNode struct {
+	cond, then, els node
+}
+
+// binaryLevels lists the left-associative operators from lowest to highest
+// precedence.
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", ">", "<=", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+var assignOps = map[string]bool{
+	"=": true, "*=": true, "/=": true, "%=": true, "+=": true, "-=": true,
+	"<<=": true, ">>=": true, "&=": true, "^=": true, "|=": true,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	expr   string
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peekOp(ops ...string) (string, bool) {
+	if p.done() || p.tokens[p.pos].kind != tokOp {
+		return "", false
+	}
+	text := p.tokens[p.pos].text
+	for _, op := range ops {
+		if text == op {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	near := ""
+	if !p.done() {
+		near = p.tokens[p.pos].text
+	}
+	return fmt.Errorf("%s: %s (error token is \"%s\")", p.expr, fmt.Sprintf(format, args...), near)
+}
+
+func (p *parser) parseComma() (node, error) {
+	x, err := p.parseAssign()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.peekOp(","); !ok {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.parseAssign()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryNode{op: ",", x: x, y: y}
+	}
+}
+
+func (p *parser) parseAssign() (node, error) {
+	if p.pos+1 < len(p.tokens) && p.tokens[p.pos].kind == tokName {
+		next := p.tokens[p.pos+1]
+		if next.kind == tokOp && assignOps[next.text] {
+			name := p.tokens[p.pos].text
+			p.pos += 2
+			x, err := p.parseAssign()
+			if err != nil {
+				return nil, err
+			}
+			return assignNode{name: name, op: next.text, x: x}, nil
+		}
+	}
+	return p.parseTernary()
+}
+
+func (p *parser) parseTernary() (node, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.peekOp("?"); !ok {
+		return cond, nil
+	}
+	p.pos++
+
+	then, err := p.parseAssign()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.peekOp(":"); !ok {
+		return nil, p.errorf("`:' expected for conditional expression")
+	}
+	p.pos++
+
+	els, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	return condNode{cond: cond, then: then, els: els}, nil
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.parsePower()
+	}
+
+	x, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOp(binaryLevels[level]...)
+		if !ok {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = binaryNode{op: op, x: x, y: y}
+	}
+}
+
+func (p *parser) parsePower() (node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.peekOp("**"); !ok {
+		return x, nil
+	}
+	p.pos++
+	y, err := p.parsePower()
+	if err != nil {
+		return nil, err
+	}
+	return binaryNode{op: "**", x: x, y: y}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if op, ok := p.peekOp("++", "--"); ok {
+		p.pos++
+		if p.done() || p.tokens[p.pos].kind != tokName {
+			return nil, p.errorf("syntax error: operand expected")
+		}
+		name := p.tokens[p.pos].text
+		p.pos++
+		return incNode{name: name, op: op, prefix: true}, nil
+	}
+
+	if op, ok := p.peekOp("!", "~", "+", "-"); ok {
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: op, x: x}, nil
+	}
+
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	if p.done() {
+		return nil, p.errorf("syntax error: operand expected")
+	}
+
+	tok := p.tokens[p.pos]
+	switch tok.kind {
+	case tokNumber:
+		p.pos++
+		return numberNode{value: tok.num}, nil
+
+	case tokName:
+		p.pos++
+		if op, ok := p.peekOp("++", "--"); ok {
+			p.pos++
+			return incNode{name: tok.text, op: op}, nil
+		}
+		return varNode{name: tok.text}, nil
+	}
+
+	if _, ok := p.peekOp("("); ok {
+		p.pos++
+		x, err := p.parseComma()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.peekOp(")"); !ok {
+			return nil, p.errorf("missing `)'")
+		}
+		p.pos++
+		return x, nil
+	}
+
+	return nil, p.errorf("syntax error: operand expected")
+}
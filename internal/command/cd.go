@@ -3,8 +3,6 @@ package command
 import (
 	"context"
 	"fmt"
-	"os"
-	"strings"
 )
 
 type CdCommand struct {
@@ -29,14 +27,9 @@ func (c CdCommand) Execute(ctx context.Context, args []string, io IO) Result {
 	}
 
 	path := args[0]
-	if strings.HasPrefix(path, "~") {
-		home, _ := os.UserHomeDir()
-		path = home + path[1:]
-	}
-
 	if err := c.changeDir(path); err != nil {
 		fmt.Fprintf(io.Stdout, "cd: %s: No such file or directory\n", path)
-		return Ok
+		return Error
 	}
 
 	return Ok
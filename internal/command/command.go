@@ -2,17 +2,33 @@ package command
 
 import (
 	"context"
+	"errors"
 	"io"
+	"syscall"
 )
 
+// Result is a command's exit status: 0 is success, anything else failure.
 type Result int
 
 const (
-	Ok Result = iota
-	Exit
-	Error
+	Ok    Result = 0
+	Error Result = 1
+	// NotExecutable and NotFound are what the shell reports for a command it
+	// found but could not run, and for one it could not find.
+	NotExecutable Result = 126
+	NotFound      Result = 127
+	// BrokenPipe is the status of a command whose output lost its reader,
+	// as if SIGPIPE had killed it.
+	BrokenPipe Result = 128 + Result(syscall.SIGPIPE)
 )
 
+// IsBrokenPipe reports whether err is a write to a pipe that nothing reads
+// any more. The shell's in-memory pipes stand in for SIGPIPE this way, so
+// a builtin ends quietly with BrokenPipe rather than reporting it.
+func IsBrokenPipe(err error) bool {
+	return errors.Is(err, io.ErrClosedPipe) || errors.Is(err, syscall.EPIPE)
+}
+
 type Command interface {
 	Name() string
 	Execute(ctx context.Context, args []string, io IO) Result
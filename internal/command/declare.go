@@ -0,0 +1,174 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Variable is a shell variable as declare -p shows it.
+type Variable struct {
+	Name  string
+	Value string
+	// Set is false for a name that has attributes but no value, as after
+	// export NAME.
+	Set      bool
+	Exported bool
+	Readonly bool
+}
+
+// Declaration returns the declare command that recreates v.
+func (v Variable) Declaration() string {
+	flags := ""
+	if v.Readonly {
+		flags += "r"
+	}
+	if v.Exported {
+		flags += "x"
+	}
+	if flags == "" {
+		flags = "-"
+	}
+
+	decl := "declare -" + flags + " " + v.Name
+	if v.Set {
+		decl += "=" + quoteValue(v.Value)
+	}
+	return decl
+}
+
+// quoteValue double-quotes s so that the shell reads it back unchanged.
+func quoteValue(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		if strings.ContainsRune("\\\"$`", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+type DeclareCommand struct {
+	setVar    func(name, value string) error
+	export    func(name string, on bool) error
+	readonly  func(name string) error
+	variables func() []Variable
+}
+
+func NewDeclareCommand(
+	setVar func(string, string) error,
+	export func(string, bool) error,
+	readonly func(string) error,
+	variables func() []Variable,
+) DeclareCommand {
+	return DeclareCommand{
+		setVar:    setVar,
+		export:    export,
+		readonly:  readonly,
+		variables: variables,
+	}
+}
+
+func (c DeclareCommand) Name() string {
+	return "declare"
+}
+
+// Execute sets each NAME=value and gives every NAME the attributes asked
+// for: -x exports, +x unexports, -r makes readonly. With -p, or without
+// names, it prints the declare commands that recreate the variables.
+func (c DeclareCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	var print, export, unexport, readonly bool
+	for len(args) > 0 && len(args[0]) > 1 && strings.ContainsRune("-+", rune(args[0][0])) {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, flag := range arg[1:] {
+			switch {
+			case flag == 'p' && arg[0] == '-':
+				print = true
+			case flag == 'x':
+				export, unexport = arg[0] == '-', arg[0] == '+'
+			case flag == 'r' && arg[0] == '-':
+				readonly = true
+			default:
+				fmt.Fprintf(io.Stderr, "declare: %s: invalid option\n", arg)
+				return Error
+			}
+		}
+	}
+
+	if print || len(args) == 0 {
+		keep := func(v Variable) bool {
+			return (!export || v.Exported) && (!readonly || v.Readonly)
+		}
+		return printDeclarations("declare", c.variables(), args, keep, io)
+	}
+
+	var attrs []func(string) error
+	if export || unexport {
+		attrs = append(attrs, func(name string) error { return c.export(name, export) })
+	}
+	if readonly {
+		attrs = append(attrs, c.readonly)
+	}
+	return declareNames("declare", args, c.setVar, attrs, io)
+}
+
+// declareNames sets each NAME=value in args, then gives every NAME the
+// attributes in attrs. It reports errors as cmd and goes on with the next
+// name.
+func declareNames(cmd string, args []string, setVar func(string, string) error, attrs []func(string) error, io IO) Result {
+	result := Ok
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		var err error
+		if hasValue {
+			err = setVar(name, value)
+		}
+		for _, attr := range attrs {
+			if err != nil {
+				break
+			}
+			err = attr(name)
+		}
+		if err != nil {
+			fmt.Fprintf(io.Stderr, "%s: %v\n", cmd, err)
+			result = Error
+		}
+	}
+	return result
+}
+
+// printDeclarations prints the declare command for each of vars that keep
+// accepts, or with names, for those variables only.
+func printDeclarations(cmd string, vars []Variable, names []string, keep func(Variable) bool, io IO) Result {
+	if len(names) == 0 {
+		for _, v := range vars {
+			if keep(v) {
+				fmt.Fprintln(io.Stdout, v.Declaration())
+			}
+		}
+		return Ok
+	}
+
+	byName := make(map[string]Variable, len(vars))
+	for _, v := range vars {
+		byName[v.Name] = v
+	}
+	result := Ok
+	for _, name := range names {
+		v, ok := byName[name]
+		if !ok || !keep(v) {
+			fmt.Fprintf(io.Stderr, "%s: %s: not found\n", cmd, name)
+			result = Error
+			continue
+		}
+		fmt.Fprintln(io.Stdout, v.Declaration())
+	}
+	return result
+}
@@ -13,6 +13,12 @@ func (c EchoCommand) Name() string {
 }
 
 func (c EchoCommand) Execute(ctx context.Context, args []string, io IO) Result {
-	fmt.Fprintln(io.Stdout, strings.Join(args, " "))
+	if _, err := fmt.Fprintln(io.Stdout, strings.Join(args, " ")); err != nil {
+		if IsBrokenPipe(err) {
+			return BrokenPipe
+		}
+		fmt.Fprintf(io.Stderr, "echo: write error: %v\n", err)
+		return Error
+	}
 	return Ok
 }
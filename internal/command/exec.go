@@ -0,0 +1,34 @@
+package command
+
+import (
+	"context"
+	"fmt"
+)
+
+type ExecCommand struct {
+	replace func(args []string, io IO) error
+}
+
+func NewExecCommand(replace func([]string, IO) error) ExecCommand {
+	return ExecCommand{
+		replace: replace,
+	}
+}
+
+func (c ExecCommand) Name() string {
+	return "exec"
+}
+
+// Execute replaces the shell with the command in args. Without arguments
+// there is nothing to do here: the shell keeps exec's redirections itself.
+func (c ExecCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	if len(args) == 0 {
+		return Ok
+	}
+
+	if err := c.replace(args, io); err != nil {
+		fmt.Fprintf(io.Stderr, "exec: %v\n", err)
+		return Error
+	}
+	return Ok
+}
@@ -1,13 +1,40 @@
 package command
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
 
-type ExitCommand struct{}
+type ExitCommand struct {
+	status func() Result
+	exit   func(Result)
+}
+
+func NewExitCommand(status func() Result, exit func(Result)) ExitCommand {
+	return ExitCommand{
+		status: status,
+		exit:   exit,
+	}
+}
 
 func (C ExitCommand) Name() string {
 	return "exit"
 }
 
+// Execute asks the shell to exit with status n, or with the status of the
+// last command when n is left out.
 func (c ExitCommand) Execute(ctx context.Context, args []string, io IO) Result {
-	return Exit
+	status := c.status()
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Fprintf(io.Stderr, "exit: %s: numeric argument required\n", args[0])
+			n = 2
+		}
+		status = Result(n & 0xff)
+	}
+
+	c.exit(status)
+	return status
 }
@@ -0,0 +1,60 @@
+package command
+
+import (
+	"context"
+	"fmt"
+)
+
+type ExportCommand struct {
+	setVar    func(name, value string) error
+	export    func(name string, on bool) error
+	variables func() []Variable
+}
+
+func NewExportCommand(
+	setVar func(string, string) error,
+	export func(string, bool) error,
+	variables func() []Variable,
+) ExportCommand {
+	return ExportCommand{
+		setVar:    setVar,
+		export:    export,
+		variables: variables,
+	}
+}
+
+func (c ExportCommand) Name() string {
+	return "export"
+}
+
+// Execute exports each NAME or NAME=value, or with -n stops exporting it.
+// With -p, or without names, it lists the exported variables.
+func (c ExportCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	on, print := true, false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, flag := range arg[1:] {
+			switch flag {
+			case 'n':
+				on = false
+			case 'p':
+				print = true
+			default:
+				fmt.Fprintf(io.Stderr, "export: %s: invalid option\n", arg)
+				return Error
+			}
+		}
+	}
+
+	if print || len(args) == 0 {
+		exported := func(v Variable) bool { return v.Exported }
+		return printDeclarations("export", c.variables(), nil, exported, io)
+	}
+
+	attr := func(name string) error { return c.export(name, on) }
+	return declareNames("export", args, c.setVar, []func(string) error{attr}, io)
+}
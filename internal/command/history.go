@@ -10,11 +10,14 @@ import (
 
 type HistoryCommand struct {
 	store *history.Store
+	// path resolves a file name against the shell's working directory
+	path func(name string) string
 }
 
-func NewHistoryCommand(store *history.Store) HistoryCommand {
+func NewHistoryCommand(store *history.Store, path func(string) string) HistoryCommand {
 	return HistoryCommand{
 		store: store,
+		path:  path,
 	}
 }
 
@@ -26,18 +29,21 @@ func (h HistoryCommand) Execute(ctx context.Context, args []string, io IO) Resul
 	if len(args) >= 2 {
 		switch args[0] {
 		case "-r":
-			if err := h.store.LoadFrom(args[1]); err != nil {
+			if err := h.store.LoadFrom(h.path(args[1])); err != nil {
 				fmt.Fprintln(io.Stderr, err)
+				return Error
 			}
 			return Ok
 		case "-w":
-			if err := h.store.WriteTo(args[1]); err != nil {
+			if err := h.store.WriteTo(h.path(args[1])); err != nil {
 				fmt.Fprintln(io.Stderr, err)
+				return Error
 			}
 			return Ok
 		case "-a":
-			if err := h.store.AppendTo(args[1]); err != nil {
+			if err := h.store.AppendTo(h.path(args[1])); err != nil {
 				fmt.Fprintln(io.Stderr, err)
+				return Error
 			}
 			return Ok
 		}
@@ -48,7 +54,7 @@ func (h HistoryCommand) Execute(ctx context.Context, args []string, io IO) Resul
 	if len(args) > 0 {
 		limit, err := strconv.Atoi(args[0])
 		if err != nil || limit < 0 {
-			return Ok
+			return Error
 		}
 		if limit < len(entries) {
 			start = len(entries) - limit
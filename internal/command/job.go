@@ -0,0 +1,262 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Job is a job in the shell's job table, as jobs shows it.
+type Job struct {
+	ID int
+	// Mark is "+" for the current job, the one fg and bg default to, "-"
+	// for the previous one and " " for the rest.
+	Mark  string
+	State string // Running, Stopped, Done or Exit N
+	Text  string
+	Pgid  int
+	PIDs  []int
+}
+
+// String formats the job the way jobs lists it and the shell reports it.
+func (j Job) String() string {
+	return fmt.Sprintf("[%d]%s  %s", j.ID, j.Mark, j.status())
+}
+
+// status is the state and the text of the job, in columns.
+func (j Job) status() string {
+	text := j.Text
+	if j.State == "Running" {
+		text += " &"
+	}
+	return fmt.Sprintf("%-24s%s", j.State, text)
+}
+
+/* =========================
+          JOBS
+========================= */
+
+type JobsCommand struct {
+	jobs func() []Job
+}
+
+func NewJobsCommand(jobs func() []Job) JobsCommand {
+	return JobsCommand{
+		jobs: jobs,
+	}
+}
+
+func (c JobsCommand) Name() string {
+	return "jobs"
+}
+
+// Execute lists the jobs; -l adds their process ids and -p prints only the
+// process group ids.
+func (c JobsCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	long, pids := false, false
+	for _, arg := range args {
+		switch arg {
+		case "-l":
+			long = true
+		case "-p":
+			pids = true
+		default:
+			fmt.Fprintf(io.Stderr, "jobs: %s: invalid option\n", arg)
+			return Error
+		}
+	}
+
+	for _, job := range c.jobs() {
+		switch {
+		case pids:
+			fmt.Fprintln(io.Stdout, job.Pgid)
+		case long:
+			ids := make([]string, len(job.PIDs))
+			for i, pid := range job.PIDs {
+				ids[i] = strconv.Itoa(pid)
+			}
+			fmt.Fprintf(io.Stdout, "[%d]%s %s %s\n", job.ID, job.Mark, strings.Join(ids, " "), job.status())
+		default:
+			fmt.Fprintln(io.Stdout, job)
+		}
+	}
+	return Ok
+}
+
+/* =========================
+         FG / BG
+========================= */
+
+type FgCommand struct {
+	lookupJob  func(spec string) (Job, error)
+	foreground func(id int) (Result, error)
+}
+
+func NewFgCommand(lookupJob func(string) (Job, error), foreground func(int) (Result, error)) FgCommand {
+	return FgCommand{
+		lookupJob:  lookupJob,
+		foreground: foreground,
+	}
+}
+
+func (c FgCommand) Name() string {
+	return "fg"
+}
+
+// Execute brings a job, the current one by default, to the foreground and
+// waits for it to finish or stop.
+func (c FgCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	job, err := c.lookupJob(jobSpec(args))
+	if err != nil {
+		fmt.Fprintf(io.Stderr, "fg: %v\n", err)
+		return Error
+	}
+	fmt.Fprintln(io.Stdout, job.Text)
+
+	status, err := c.foreground(job.ID)
+	if err != nil {
+		fmt.Fprintf(io.Stderr, "fg: %v\n", err)
+		return Error
+	}
+	return status
+}
+
+type BgCommand struct {
+	lookupJob  func(spec string) (Job, error)
+	background func(id int) error
+}
+
+func NewBgCommand(lookupJob func(string) (Job, error), background func(int) error) BgCommand {
+	return BgCommand{
+		lookupJob:  lookupJob,
+		background: background,
+	}
+}
+
+func (c BgCommand) Name() string {
+	return "bg"
+}
+
+// Execute lets stopped jobs, the current one by default, go on running in
+// the background.
+func (c BgCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	result := Ok
+	for _, spec := range args {
+		job, err := c.lookupJob(spec)
+		if err == nil {
+			err = c.background(job.ID)
+		}
+		if err != nil {
+			fmt.Fprintf(io.Stderr, "bg: %v\n", err)
+			result = Error
+			continue
+		}
+		fmt.Fprintf(io.Stdout, "[%d]%s %s &\n", job.ID, job.Mark, job.Text)
+	}
+	return result
+}
+
+// jobSpec returns the job named in args, or "" for the current job.
+func jobSpec(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+/* =========================
+       WAIT / DISOWN
+========================= */
+
+type WaitCommand struct {
+	lookupJob func(spec string) (Job, error)
+	jobs      func() []Job
+	waitJob   func(ctx context.Context, id int) (Result, error)
+}
+
+func NewWaitCommand(
+	lookupJob func(string) (Job, error),
+	jobs func() []Job,
+	waitJob func(context.Context, int) (Result, error),
+) WaitCommand {
+	return WaitCommand{
+		lookupJob: lookupJob,
+		jobs:      jobs,
+		waitJob:   waitJob,
+	}
+}
+
+func (c WaitCommand) Name() string {
+	return "wait"
+}
+
+// Execute waits for each job or process id given, or without arguments for
+// every running job, and returns the status of the last one.
+func (c WaitCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	if len(args) == 0 {
+		for _, job := range c.jobs() {
+			if job.State != "Running" {
+				continue
+			}
+			// a job that finished meanwhile needs no waiting for
+			c.waitJob(ctx, job.ID)
+			if ctx.Err() != nil {
+				return Error
+			}
+		}
+		return Ok
+	}
+
+	result := Ok
+	for _, spec := range args {
+		job, err := c.lookupJob(spec)
+		if err != nil {
+			fmt.Fprintf(io.Stderr, "wait: %v\n", err)
+			result = NotFound
+			continue
+		}
+		if result, err = c.waitJob(ctx, job.ID); err != nil {
+			return Error
+		}
+	}
+	return result
+}
+
+type DisownCommand struct {
+	lookupJob func(spec string) (Job, error)
+	disown    func(id int)
+}
+
+func NewDisownCommand(lookupJob func(string) (Job, error), disown func(int)) DisownCommand {
+	return DisownCommand{
+		lookupJob: lookupJob,
+		disown:    disown,
+	}
+}
+
+func (c DisownCommand) Name() string {
+	return "disown"
+}
+
+// Execute takes jobs, the current one by default, out of the job table, so
+// the shell no longer reports on them or waits for them.
+func (c DisownCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	result := Ok
+	for _, spec := range args {
+		job, err := c.lookupJob(spec)
+		if err != nil {
+			fmt.Fprintf(io.Stderr, "disown: %v\n", err)
+			result = Error
+			continue
+		}
+		c.disown(job.ID)
+	}
+	return result
+}
@@ -0,0 +1,173 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// signals are the signals kill knows by name, in number order.
+var signals = []struct {
+	name string
+	sig  syscall.Signal
+}{
+	{"HUP", syscall.SIGHUP},
+	{"INT", syscall.SIGINT},
+	{"QUIT", syscall.SIGQUIT},
+	{"ILL", syscall.SIGILL},
+	{"TRAP", syscall.SIGTRAP},
+	{"ABRT", syscall.SIGABRT},
+	{"BUS", syscall.SIGBUS},
+	{"FPE", syscall.SIGFPE},
+	{"KILL", syscall.SIGKILL},
+	{"USR1", syscall.SIGUSR1},
+	{"SEGV", syscall.SIGSEGV},
+	{"USR2", syscall.SIGUSR2},
+	{"PIPE", syscall.SIGPIPE},
+	{"ALRM", syscall.SIGALRM},
+	{"TERM", syscall.SIGTERM},
+	{"CHLD", syscall.SIGCHLD},
+	{"CONT", syscall.SIGCONT},
+	{"STOP", syscall.SIGSTOP},
+	{"TSTP", syscall.SIGTSTP},
+	{"TTIN", syscall.SIGTTIN},
+	{"TTOU", syscall.SIGTTOU},
+	{"URG", syscall.SIGURG},
+	{"XCPU", syscall.SIGXCPU},
+	{"XFSZ", syscall.SIGXFSZ},
+	{"VTALRM", syscall.SIGVTALRM},
+	{"PROF", syscall.SIGPROF},
+	{"WINCH", syscall.SIGWINCH},
+	{"IO", syscall.SIGIO},
+	{"SYS", syscall.SIGSYS},
+}
+
+// ParseSignal reads a signal given by number or by name, with or without
+// the SIG prefix.
+func ParseSignal(s string) (syscall.Signal, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return syscall.Signal(n), n >= 0 && n < 65
+	}
+	name := strings.TrimPrefix(strings.ToUpper(s), "SIG")
+	for _, sig := range signals {
+		if sig.name == name {
+			return sig.sig, true
+		}
+	}
+	return 0, false
+}
+
+// SignalName returns the name of sig without the SIG prefix.
+func SignalName(sig syscall.Signal) string {
+	for _, s := range signals {
+		if s.sig == sig {
+			return s.name
+		}
+	}
+	return strconv.Itoa(int(sig))
+}
+
+// listSignals prints the signals with their numbers, for kill -l and
+// trap -l.
+func listSignals(io IO) {
+	for _, s := range signals {
+		fmt.Fprintf(io.Stdout, "%2d) SIG%s\n", int(s.sig), s.name)
+	}
+}
+
+type KillCommand struct {
+	lookupJob func(spec string) (Job, error)
+	// queueSignal hands a signal sent to the shell itself straight to its
+	// trap, so that the trap runs before the next command rather than
+	// whenever the signal arrives. It reports false for a signal with no
+	// trap, which is then sent as usual.
+	queueSignal func(sig syscall.Signal) bool
+}
+
+func NewKillCommand(
+	lookupJob func(string) (Job, error),
+	queueSignal func(syscall.Signal) bool,
+) KillCommand {
+	return KillCommand{
+		lookupJob:   lookupJob,
+		queueSignal: queueSignal,
+	}
+}
+
+func (c KillCommand) Name() string {
+	return "kill"
+}
+
+// Execute sends a signal, TERM unless -s NAME, -NAME or -N says otherwise,
+// to each process id or %job. kill -l lists the signal names.
+func (c KillCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	sig := syscall.SIGTERM
+	if len(args) > 0 && args[0] == "-l" {
+		listSignals(io)
+		return Ok
+	}
+	if len(args) > 1 && args[0] == "-s" {
+		args = append([]string{"-" + args[1]}, args[2:]...)
+	}
+	if len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' && args[0] != "--" {
+		s, ok := ParseSignal(args[0][1:])
+		if !ok {
+			fmt.Fprintf(io.Stderr, "kill: %s: invalid signal specification\n", args[0][1:])
+			return Error
+		}
+		sig, args = s, args[1:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(io.Stderr, "kill: usage: kill [-s sigspec | -signum | -sigspec] pid | jobspec ... or kill -l")
+		return Error
+	}
+
+	result := Ok
+	for _, arg := range args {
+		if err := c.kill(arg, sig); err != nil {
+			fmt.Fprintf(io.Stderr, "kill: %v\n", err)
+			result = Error
+		}
+	}
+	return result
+}
+
+// kill sends sig to target, a pid or a job spec. Its errors name the
+// target, as those of the job lookup do.
+func (c KillCommand) kill(target string, sig syscall.Signal) error {
+	if !strings.HasPrefix(target, "%") {
+		pid, err := strconv.Atoi(target)
+		if err != nil {
+			return fmt.Errorf("%s: arguments must be process or job IDs", target)
+		}
+		if pid == os.Getpid() && c.queueSignal(sig) {
+			return nil
+		}
+		if err := syscall.Kill(pid, sig); err != nil {
+			return fmt.Errorf("%s: %w", target, err)
+		}
+		return nil
+	}
+
+	job, err := c.lookupJob(target)
+	if err != nil {
+		return err
+	}
+	if job.Pgid == 0 {
+		return fmt.Errorf("%s: no processes", target)
+	}
+	if err := syscall.Kill(-job.Pgid, sig); err != nil {
+		return fmt.Errorf("%s: %w", target, err)
+	}
+	// a stopped job only acts on the signal once it runs again
+	if job.State == "Stopped" && sig != syscall.SIGSTOP && sig != syscall.SIGTSTP && sig != syscall.SIGCONT {
+		return syscall.Kill(-job.Pgid, syscall.SIGCONT)
+	}
+	return nil
+}
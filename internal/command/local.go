@@ -0,0 +1,43 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type LocalCommand struct {
+	local  func(name string) error
+	setVar func(name, value string) error
+}
+
+func NewLocalCommand(local func(string) error, setVar func(string, string) error) LocalCommand {
+	return LocalCommand{
+		local:  local,
+		setVar: setVar,
+	}
+}
+
+func (c LocalCommand) Name() string {
+	return "local"
+}
+
+// Execute makes each NAME or NAME=value local to the running function.
+func (c LocalCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	result := Ok
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if err := c.local(name); err != nil {
+			fmt.Fprintf(io.Stderr, "local: %v\n", err)
+			return Error
+		}
+		if !hasValue {
+			continue
+		}
+		if err := c.setVar(name, value); err != nil {
+			fmt.Fprintf(io.Stderr, "local: %v\n", err)
+			result = Error
+		}
+	}
+	return result
+}
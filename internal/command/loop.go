@@ -0,0 +1,44 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// LoopCommand is break or continue. Both take the number of enclosing loops
+// to act on, 1 by default.
+type LoopCommand struct {
+	name string
+	jump func(levels int) error
+}
+
+func NewBreakCommand(jump func(int) error) LoopCommand {
+	return LoopCommand{name: "break", jump: jump}
+}
+
+func NewContinueCommand(jump func(int) error) LoopCommand {
+	return LoopCommand{name: "continue", jump: jump}
+}
+
+func (c LoopCommand) Name() string {
+	return c.name
+}
+
+func (c LoopCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	levels := 1
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			fmt.Fprintf(io.Stderr, "%s: %s: loop count out of range\n", c.name, args[0])
+			return Error
+		}
+		levels = n
+	}
+
+	if err := c.jump(levels); err != nil {
+		fmt.Fprintf(io.Stderr, "%s: %v\n", c.name, err)
+		return Error
+	}
+	return Ok
+}
@@ -3,17 +3,23 @@ package command
 import (
 	"context"
 	"fmt"
-	"os"
 )
 
-type PwdCommand struct{}
+type PwdCommand struct {
+	dir func() string
+}
+
+func NewPwdCommand(dir func() string) PwdCommand {
+	return PwdCommand{
+		dir: dir,
+	}
+}
 
 func (c PwdCommand) Name() string {
 	return "pwd"
 }
 
 func (c PwdCommand) Execute(ctx context.Context, args []string, io IO) Result {
-	currentWorkingDirectory, _ := os.Getwd()
-	fmt.Fprintln(io.Stdout, currentWorkingDirectory)
+	fmt.Fprintln(io.Stdout, c.dir())
 	return Ok
 }
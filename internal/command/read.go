@@ -0,0 +1,116 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type ReadCommand struct {
+	lookupVar func(string) (string, bool)
+	setVar    func(string, string) error
+}
+
+func NewReadCommand(
+	lookupVar func(string) (string, bool),
+	setVar func(string, string) error,
+) ReadCommand {
+	return ReadCommand{
+		lookupVar: lookupVar,
+		setVar:    setVar,
+	}
+}
+
+func (c ReadCommand) Name() string {
+	return "read"
+}
+
+// Execute reads one line and splits it on IFS into the named variables, the
+// last one taking the rest of the line. Without names the line goes to
+// REPLY. Unless -r is given, a backslash quotes the next character and a
+// backslash-newline continues the line.
+func (c ReadCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	raw := false
+	if len(args) > 0 && args[0] == "-r" {
+		raw, args = true, args[1:]
+	}
+	names := args
+	if len(names) == 0 {
+		names = []string{"REPLY"}
+	}
+
+	line, ok := readLine(io.Stdin, raw)
+
+	ifs, set := c.lookupVar("IFS")
+	if !set {
+		ifs = " \t\n"
+	}
+	fields := splitRead(line, ifs, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(fields) {
+			value = fields[i]
+		}
+		if err := c.setVar(name, value); err != nil {
+			fmt.Fprintf(io.Stderr, "read: %v\n", err)
+			return Error
+		}
+	}
+
+	if !ok {
+		return Error
+	}
+	return Ok
+}
+
+// readLine reads up to a newline one byte at a time, so that nothing past
+// the line is taken from a stream other commands go on to read. ok is false
+// at end of input.
+func readLine(r io.Reader, raw bool) (string, bool) {
+	var b strings.Builder
+	buf := make([]byte, 1)
+	escaped := false
+	for {
+		if n, err := r.Read(buf); n == 0 || err != nil {
+			return b.String(), false
+		}
+		ch := buf[0]
+		switch {
+		case escaped:
+			escaped = false
+			if ch != '\n' {
+				b.WriteByte(ch)
+			}
+		case ch == '\\' && !raw:
+			escaped = true
+		case ch == '\n':
+			return b.String(), true
+		default:
+			b.WriteByte(ch)
+		}
+	}
+}
+
+// splitRead splits line into at most n fields. Blanks in ifs around fields
+// are dropped; the last field keeps the rest of the line as is.
+func splitRead(line, ifs string, n int) []string {
+	isSep := func(r rune) bool { return strings.ContainsRune(ifs, r) }
+	isBlankSep := func(r rune) bool { return isSep(r) && (r == ' ' || r == '\t' || r == '\n') }
+
+	line = strings.TrimFunc(line, isBlankSep)
+	var fields []string
+	for len(fields) < n-1 && line != "" {
+		end := strings.IndexFunc(line, isSep)
+		if end < 0 {
+			break
+		}
+		fields = append(fields, line[:end])
+		line = strings.TrimLeftFunc(line[end:], isBlankSep)
+		// one non-blank separator may follow the blanks
+		if line != "" && isSep(rune(line[0])) {
+			line = strings.TrimLeftFunc(line[1:], isBlankSep)
+		}
+	}
+	return append(fields, line)
+}
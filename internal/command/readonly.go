@@ -0,0 +1,52 @@
+package command
+
+import (
+	"context"
+	"fmt"
+)
+
+type ReadonlyCommand struct {
+	setVar    func(name, value string) error
+	readonly  func(name string) error
+	variables func() []Variable
+}
+
+func NewReadonlyCommand(
+	setVar func(string, string) error,
+	readonly func(string) error,
+	variables func() []Variable,
+) ReadonlyCommand {
+	return ReadonlyCommand{
+		setVar:    setVar,
+		readonly:  readonly,
+		variables: variables,
+	}
+}
+
+func (c ReadonlyCommand) Name() string {
+	return "readonly"
+}
+
+// Execute makes each NAME or NAME=value readonly. With -p, or without names,
+// it lists the readonly variables.
+func (c ReadonlyCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	print := false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		if arg != "-p" {
+			fmt.Fprintf(io.Stderr, "readonly: %s: invalid option\n", arg)
+			return Error
+		}
+		print = true
+	}
+
+	if print || len(args) == 0 {
+		readonly := func(v Variable) bool { return v.Readonly }
+		return printDeclarations("readonly", c.variables(), nil, readonly, io)
+	}
+	return declareNames("readonly", args, c.setVar, []func(string) error{c.readonly}, io)
+}
@@ -0,0 +1,43 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+type ReturnCommand struct {
+	status func() Result
+	ret    func(Result) error
+}
+
+func NewReturnCommand(status func() Result, ret func(Result) error) ReturnCommand {
+	return ReturnCommand{
+		status: status,
+		ret:    ret,
+	}
+}
+
+func (c ReturnCommand) Name() string {
+	return "return"
+}
+
+// Execute ends the running function with status n, or with the status of
+// the last command when n is left out.
+func (c ReturnCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	status := c.status()
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Fprintf(io.Stderr, "return: %s: numeric argument required\n", args[0])
+			n = 2
+		}
+		status = Result(n & 0xff)
+	}
+
+	if err := c.ret(status); err != nil {
+		fmt.Fprintf(io.Stderr, "return: %v\n", err)
+		return Error
+	}
+	return status
+}
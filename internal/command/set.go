@@ -0,0 +1,73 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+type SetCommand struct {
+	setOption func(name string, on bool) error
+	options   func() map[string]bool
+}
+
+func NewSetCommand(
+	setOption func(string, bool) error,
+	options func() map[string]bool,
+) SetCommand {
+	return SetCommand{
+		setOption: setOption,
+		options:   options,
+	}
+}
+
+func (c SetCommand) Name() string {
+	return "set"
+}
+
+// Execute handles set -o name and set +o name. Without a name, -o lists the
+// options and +o prints the set commands that restore them.
+func (c SetCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-o", "+o":
+			on := args[i] == "-o"
+			if i+1 >= len(args) {
+				c.printOptions(io, on)
+				continue
+			}
+			i++
+			if err := c.setOption(args[i], on); err != nil {
+				fmt.Fprintf(io.Stderr, "set: %v\n", err)
+				return Error
+			}
+		default:
+			fmt.Fprintf(io.Stderr, "set: %s: invalid option\n", args[i])
+			return Error
+		}
+	}
+	return Ok
+}
+
+func (c SetCommand) printOptions(io IO, table bool) {
+	options := c.options()
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		on := options[name]
+		switch {
+		case table && on:
+			fmt.Fprintf(io.Stdout, "%-15s\ton\n", name)
+		case table:
+			fmt.Fprintf(io.Stdout, "%-15s\toff\n", name)
+		case on:
+			fmt.Fprintf(io.Stdout, "set -o %s\n", name)
+		default:
+			fmt.Fprintf(io.Stdout, "set +o %s\n", name)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Trap is a trap as trap -p shows it: the commands to run and the signal,
+// or pseudo-signal such as EXIT, that runs them. An empty Action ignores
+// the signal.
+type Trap struct {
+	Name   string
+	Action string
+}
+
+// String returns the trap command that sets t again.
+func (t Trap) String() string {
+	return "trap -- " + singleQuote(t.Action) + " " + t.Name
+}
+
+// singleQuote single-quotes s so that the shell reads it back unchanged.
+func singleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// trapName returns the name trap keeps a signal under: SIGINT for INT, 2 or
+// sigint, and EXIT for 0.
+func trapName(spec string) (string, bool) {
+	switch name := strings.ToUpper(spec); name {
+	case "0", "EXIT", "ERR", "DEBUG", "RETURN":
+		if name == "0" {
+			name = "EXIT"
+		}
+		return name, true
+	}
+	sig, ok := ParseSignal(spec)
+	if !ok {
+		return "", false
+	}
+	name := SignalName(sig)
+	if _, err := strconv.Atoi(name); err == nil {
+		return "", false
+	}
+	return "SIG" + name, true
+}
+
+type TrapCommand struct {
+	setTrap func(name, action string)
+	traps   func() []Trap
+}
+
+func NewTrapCommand(setTrap func(string, string), traps func() []Trap) TrapCommand {
+	return TrapCommand{
+		setTrap: setTrap,
+		traps:   traps,
+	}
+}
+
+func (c TrapCommand) Name() string {
+	return "trap"
+}
+
+// Execute sets the commands run when each signal given arrives: trap ACTION
+// SIG..., or trap - SIG... to go back to the default. trap -p, or trap
+// alone, prints the traps set and trap -l lists the signals.
+func (c TrapCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	if len(args) > 0 && args[0] == "-l" {
+		listSignals(io)
+		return Ok
+	}
+	if len(args) > 0 && args[0] == "-p" {
+		return c.print(args[1:], io)
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return c.print(nil, io)
+	}
+
+	action, names := args[0], args[1:]
+	if _, err := strconv.Atoi(action); err == nil || len(args) == 1 {
+		// a lone signal, or one given first by number, goes back to the
+		// default
+		action, names = "-", args
+	}
+
+	result := Ok
+	for _, spec := range names {
+		name, ok := trapName(spec)
+		if !ok {
+			fmt.Fprintf(io.Stderr, "trap: %s: invalid signal specification\n", spec)
+			result = Error
+			continue
+		}
+		c.setTrap(name, action)
+	}
+	return result
+}
+
+// print prints the trap command for each trap set, or with specs, for those
+// signals only.
+func (c TrapCommand) print(specs []string, io IO) Result {
+	traps := c.traps()
+	if len(specs) == 0 {
+		for _, t := range traps {
+			fmt.Fprintln(io.Stdout, t)
+		}
+		return Ok
+	}
+
+	result := Ok
+	for _, spec := range specs {
+		name, ok := trapName(spec)
+		if !ok {
+			fmt.Fprintf(io.Stderr, "trap: %s: invalid signal specification\n", spec)
+			result = Error
+			continue
+		}
+		for _, t := range traps {
+			if t.Name == name {
+				fmt.Fprintln(io.Stdout, t)
+			}
+		}
+	}
+	return result
+}
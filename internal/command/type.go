@@ -6,15 +6,18 @@ import (
 )
 
 type TypeCommand struct {
+	function     func(string) (string, bool)
 	isBuiltin    func(string) bool
 	isExecutable func(string) (string, bool)
 }
 
 func NewTypeCommand(
+	function func(string) (string, bool),
 	isBuiltin func(string) bool,
 	isExecutable func(string) (string, bool),
 ) TypeCommand {
 	return TypeCommand{
+		function:     function,
 		isBuiltin:    isBuiltin,
 		isExecutable: isExecutable,
 	}
@@ -31,6 +34,11 @@ func (c TypeCommand) Execute(ctx context.Context, args []string, io IO) Result {
 
 	name := args[0]
 
+	if source, ok := c.function(name); ok {
+		fmt.Fprintf(io.Stdout, "%s is a function\n%s\n", name, source)
+		return Ok
+	}
+
 	if c.isBuiltin(name) {
 		fmt.Fprintf(io.Stdout, "%s is a shell builtin\n", name)
 		return Ok
@@ -43,5 +51,5 @@ func (c TypeCommand) Execute(ctx context.Context, args []string, io IO) Result {
 	}
 
 	fmt.Fprintf(io.Stdout, "%s: not found\n", name)
-	return Ok
+	return Error
 }
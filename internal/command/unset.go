@@ -0,0 +1,53 @@
+package command
+
+import (
+	"context"
+	"fmt"
+)
+
+type UnsetCommand struct {
+	unsetVar      func(name string) error
+	unsetFunction func(name string) error
+}
+
+func NewUnsetCommand(unsetVar, unsetFunction func(string) error) UnsetCommand {
+	return UnsetCommand{
+		unsetVar:      unsetVar,
+		unsetFunction: unsetFunction,
+	}
+}
+
+func (c UnsetCommand) Name() string {
+	return "unset"
+}
+
+// Execute unsets each NAME: a variable, or with -f a function.
+func (c UnsetCommand) Execute(ctx context.Context, args []string, io IO) Result {
+	unset := c.unsetVar
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		switch arg {
+		case "-v":
+			unset = c.unsetVar
+		case "-f":
+			unset = c.unsetFunction
+		case "--":
+		default:
+			fmt.Fprintf(io.Stderr, "unset: %s: invalid option\n", arg)
+			return Error
+		}
+		if arg == "--" {
+			break
+		}
+	}
+
+	result := Ok
+	for _, name := range args {
+		if err := unset(name); err != nil {
+			fmt.Fprintf(io.Stderr, "unset: %v\n", err)
+			result = Error
+		}
+	}
+	return result
+}
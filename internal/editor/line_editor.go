@@ -4,11 +4,13 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"sync"
 
 	"golang.org/x/term"
 )
 
 type LineEditor struct {
+	prompt      string
 	buffer      []rune
 	builtins    []string
 	executables []string
@@ -17,10 +19,17 @@ type LineEditor struct {
 	history    []string
 	histIndex  int
 	savedInput []rune
+
+	// mu guards the line and the terminal against Suspend, which is called
+	// from another goroutine; raw is the terminal state to go back to
+	// while ReadLine has the terminal in raw mode, and nil otherwise.
+	mu  sync.Mutex
+	raw *term.State
 }
 
 func New(candidates []string, excutables []string) *LineEditor {
 	return &LineEditor{
+		prompt:      "$ ",
 		buffer:      make([]rune, 0),
 		builtins:    candidates,
 		executables: excutables,
@@ -28,6 +37,12 @@ func New(candidates []string, excutables []string) *LineEditor {
 	}
 }
 
+// SetPrompt sets the prompt redrawn together with the line; the caller still
+// prints it before ReadLine.
+func (e *LineEditor) SetPrompt(prompt string) {
+	e.prompt = prompt
+}
+
 func (e *LineEditor) SetHistory(entries []string) {
 	e.history = entries
 	if e.histIndex >= len(entries) {
@@ -38,15 +53,24 @@ func (e *LineEditor) SetHistory(entries []string) {
 func (e *LineEditor) ReadLine() (string, error) {
 	fd := int(os.Stdin.Fd())
 
+	e.mu.Lock()
 	oldState, err := term.MakeRaw(fd)
 	if err != nil {
+		e.mu.Unlock()
 		return "", err
 	}
-	defer term.Restore(fd, oldState)
-
+	e.raw = oldState
 	e.buffer = e.buffer[:0]
 	e.histIndex = -1
 	e.savedInput = nil
+	e.mu.Unlock()
+
+	defer func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		term.Restore(fd, e.raw)
+		e.raw = nil
+	}()
 
 	for {
 		var b [1]byte
@@ -54,39 +78,76 @@ func (e *LineEditor) ReadLine() (string, error) {
 			return "", err
 		}
 
-		switch b[0] {
-		case 27: // ESC
-			seq, err := e.readEscapeSeq()
-			if err != nil {
-				return "", err
-			}
-			if len(seq) == 2 && seq[0] == '[' {
-				switch seq[1] {
-				case 'A':
-					e.historyUp()
-				case 'B':
-					e.historyDown()
-				}
-			}
+		line, done, err := e.handleKey(b[0])
+		if done || err != nil {
+			return line, err
+		}
+	}
+}
 
-		case '\n', '\r':
-			os.Stdout.Write([]byte("\r\n"))
-			return string(e.buffer), nil
+// Suspend runs fn on a line of its own with the terminal as it was before
+// ReadLine, then redraws the prompt and the line typed so far. It lets a
+// trap run while a line is being read.
+func (e *LineEditor) Suspend(fn func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.raw == nil {
+		fn()
+		return
+	}
 
-		case '\t':
-			e.autocomplete()
+	fd := int(os.Stdin.Fd())
+	os.Stdout.Write([]byte("\r\n"))
+	term.Restore(fd, e.raw)
+	fn()
+	term.MakeRaw(fd)
+	e.redraw()
+}
 
-		case 127: // backspace
-			if len(e.buffer) > 0 {
-				e.buffer = e.buffer[:len(e.buffer)-1]
-				os.Stdout.Write([]byte("\b \b"))
+// handleKey deals with one byte read in raw mode. It reports the line once
+// Enter finishes it.
+func (e *LineEditor) handleKey(b byte) (line string, done bool, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch b {
+	case 27: // ESC
+		seq, err := e.readEscapeSeq()
+		if err != nil {
+			return "", false, err
+		}
+		if len(seq) == 2 && seq[0] == '[' {
+			switch seq[1] {
+			case 'A':
+				e.historyUp()
+			case 'B':
+				e.historyDown()
 			}
+		}
 
-		default:
-			e.buffer = append(e.buffer, rune(b[0]))
-			os.Stdout.Write(b[:])
+	case '\n', '\r':
+		os.Stdout.Write([]byte("\r\n"))
+		return string(e.buffer), true, nil
+
+	case 3: // Ctrl-C drops the line and starts over
+		e.buffer = e.buffer[:0]
+		e.histIndex = -1
+		os.Stdout.Write([]byte("^C\r\n" + e.prompt))
+
+	case '\t':
+		e.autocomplete()
+
+	case 127: // backspace
+		if len(e.buffer) > 0 {
+			e.buffer = e.buffer[:len(e.buffer)-1]
+			os.Stdout.Write([]byte("\b \b"))
 		}
+
+	default:
+		e.buffer = append(e.buffer, rune(b))
+		os.Stdout.Write([]byte{b})
 	}
+	return "", false, nil
 }
 
 func (e *LineEditor) readEscapeSeq() ([]byte, error) {
@@ -132,7 +193,7 @@ func (e *LineEditor) historyDown() {
 
 func (e *LineEditor) redraw() {
 	os.Stdout.Write([]byte("\r\033[K"))
-	os.Stdout.Write([]byte("$ "))
+	os.Stdout.Write([]byte(e.prompt))
 	os.Stdout.Write([]byte(string(e.buffer)))
 	e.lastWasTab = false
 }
@@ -253,7 +314,7 @@ func (e *LineEditor) listCandidates(matches []string) {
 	os.Stdout.Write([]byte("\r\n"))
 
 	// redibujar prompt + buffer
-	os.Stdout.Write([]byte("$ "))
+	os.Stdout.Write([]byte(e.prompt))
 	os.Stdout.Write([]byte(string(e.buffer)))
 
 	e.lastWasTab = false
@@ -0,0 +1,246 @@
+package lexer
+
+import (
+	"strconv"
+	"strings"
+)
+
+/* =========================
+     BRACE EXPANSION
+========================= */
+
+// braceItem is one unquoted character of a word, or a chunk that brace
+// expansion must leave alone: quoted text and $-expansions.
+type braceItem struct {
+	part   Part
+	opaque bool
+}
+
+func (it braceItem) is(ch byte) bool {
+	return !it.opaque && it.part.Text == string(ch)
+}
+
+// expandBraces turns a word such as a{b,c}d or x{1..3} into several words.
+// Only braces in unquoted text take part.
+func expandBraces(tok Token) []Token {
+	items := braceItems(tok)
+	hasBrace := false
+	for _, it := range items {
+		if it.is('{') {
+			hasBrace = true
+			break
+		}
+	}
+	if !hasBrace {
+		return []Token{tok}
+	}
+
+	var out []Token
+	for _, expanded := range expandBraceItems(items) {
+		out = append(out, tokenFromItems(tok, expanded))
+	}
+	return out
+}
+
+func braceItems(tok Token) []braceItem {
+	var items []braceItem
+	for _, part := range tok.Parts {
+		if part.Quote != Unquoted {
+			items = append(items, braceItem{part: part, opaque: true})
+			continue
+		}
+
+		text := part.Text
+		for i := 0; i < len(text); i++ {
+			end := i
+			switch {
+			case text[i] == '$' && i+1 < len(text) && (text[i+1] == '{' || text[i+1] == '('):
+				end = closingIndex(text, i+1)
+			case text[i] == '`':
+				end = backquoteEnd(text, i+1)
+			}
+			if end < i {
+				end = len(text) - 1
+			}
+			items = append(items, braceItem{
+				part:   Part{Text: text[i : end+1], Quote: Unquoted},
+				opaque: end > i,
+			})
+			i = end
+		}
+	}
+	return items
+}
+
+func expandBraceItems(items []braceItem) [][]braceItem {
+	for open := 0; open < len(items); open++ {
+		if !items[open].is('{') {
+			continue
+		}
+
+		close, commas := braceClose(items, open)
+		if close < 0 {
+			continue
+		}
+
+		var alternatives [][]braceItem
+		if len(commas) > 0 {
+			start := open + 1
+			for _, comma := range append(commas, close) {
+				alternatives = append(alternatives, items[start:comma])
+				start = comma + 1
+			}
+		} else {
+			seq, ok := braceSequence(items[open+1 : close])
+			if !ok {
+				continue
+			}
+			for _, text := range seq {
+				alternatives = append(alternatives, []braceItem{{part: Part{Text: text, Quote: Unquoted}, opaque: true}})
+			}
+		}
+
+		prefix, suffix := items[:open], items[close+1:]
+		var out [][]braceItem
+		for _, alt := range alternatives {
+			word := make([]braceItem, 0, len(prefix)+len(alt)+len(suffix))
+			word = append(word, prefix...)
+			word = append(word, alt...)
+			word = append(word, suffix...)
+			out = append(out, expandBraceItems(word)...)
+		}
+		return out
+	}
+
+	return [][]braceItem{items}
+}
+
+// braceClose finds the } matching the { at open and the top-level commas in
+// between.
+func braceClose(items []braceItem, open int) (int, []int) {
+	depth := 0
+	var commas []int
+	for i := open; i < len(items); i++ {
+		switch {
+		case items[i].is('{'):
+			depth++
+		case items[i].is('}'):
+			depth--
+			if depth == 0 {
+				return i, commas
+			}
+		case items[i].is(',') && depth == 1:
+			commas = append(commas, i)
+		}
+	}
+	return -1, nil
+}
+
+// braceSequence expands the inside of {x..y} or {x..y..step} for integers or
+// single letters. Integers written with a leading zero are padded.
+func braceSequence(items []braceItem) ([]string, bool) {
+	var b strings.Builder
+	for _, it := range items {
+		if it.opaque {
+			return nil, false
+		}
+		b.WriteString(it.part.Text)
+	}
+
+	fields := strings.Split(b.String(), "..")
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, false
+	}
+
+	step := 1
+	if len(fields) == 3 {
+		n, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, false
+		}
+		step = n
+	}
+	if step < 0 {
+		step = -step
+	}
+	if step == 0 {
+		step = 1
+	}
+
+	if isLetter(fields[0]) && isLetter(fields[1]) {
+		from, to := int(fields[0][0]), int(fields[1][0])
+		var seq []string
+		for _, n := range braceRange(from, to, step) {
+			seq = append(seq, string(rune(n)))
+		}
+		return seq, true
+	}
+
+	from, err1 := strconv.Atoi(fields[0])
+	to, err2 := strconv.Atoi(fields[1])
+	if err1 != nil || err2 != nil {
+		return nil, false
+	}
+
+	width := 0
+	if isZeroPadded(fields[0]) || isZeroPadded(fields[1]) {
+		width = max(len(fields[0]), len(fields[1]))
+	}
+
+	var seq []string
+	for _, n := range braceRange(from, to, step) {
+		seq = append(seq, padInt(n, width))
+	}
+	return seq, true
+}
+
+func braceRange(from, to, step int) []int {
+	var out []int
+	if from <= to {
+		for n := from; n <= to; n += step {
+			out = append(out, n)
+		}
+	} else {
+		for n := from; n >= to; n -= step {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func padInt(n, width int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	for len(sign)+len(digits) < width {
+		digits = "0" + digits
+	}
+	return sign + digits
+}
+
+func isZeroPadded(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0'
+}
+
+func isLetter(s string) bool {
+	return len(s) == 1 && (('a' <= s[0] && s[0] <= 'z') || ('A' <= s[0] && s[0] <= 'Z'))
+}
+
+func tokenFromItems(orig Token, items []braceItem) Token {
+	tok := Token{Kind: orig.Kind, Pos: orig.Pos}
+	var value strings.Builder
+	for _, it := range items {
+		value.WriteString(it.part.Text)
+		n := len(tok.Parts)
+		if n > 0 && tok.Parts[n-1].Quote == it.part.Quote {
+			tok.Parts[n-1].Text += it.part.Text
+			continue
+		}
+		tok.Parts = append(tok.Parts, it.part)
+	}
+	tok.Value = value.String()
+	return tok
+}
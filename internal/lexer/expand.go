@@ -0,0 +1,408 @@
+package lexer
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/arith"
+)
+
+/* =========================
+     WORD EXPANSION
+========================= */
+
+// Variables is the view of the shell's parameters that expansion needs.
+type Variables interface {
+	LookupVar(name string) (string, bool)
+	SetVar(name, value string) error
+}
+
+// Arrays is implemented by variable tables that also hold indexed arrays,
+// such as PIPESTATUS.
+type Arrays interface {
+	LookupArray(name string) ([]string, bool)
+}
+
+type Expander struct {
+	vars       Variables
+	dir        string
+	substitute func(src string) (string, error)
+	// assignment is set while the word of an assignment expands, so that
+	// the operands of its ${...} forms take tildes after a : as well.
+	assignment bool
+}
+
+// NewExpander builds an expander; relative patterns are globbed in dir, and
+// substitute runs the text of a command substitution and returns what it
+// wrote to stdout.
+func NewExpander(vars Variables, dir string, substitute func(src string) (string, error)) *Expander {
+	return &Expander{
+		vars:       vars,
+		dir:        dir,
+		substitute: substitute,
+	}
+}
+
+// fragment is a piece of an expanded word.
+type fragment struct {
+	text   string
+	quoted bool // protected from field splitting and globbing
+	split  bool // produced by an unquoted expansion, so subject to splitting
+	// fieldBreak separates the elements of "${a[@]}": it ends a field even
+	// when quoted, and reads as a space when the word is not split.
+	fieldBreak bool
+}
+
+// ExpandWords brace-expands every word token, expands the results, splits
+// them into fields and globs the fields against the filesystem.
+func (x *Expander) ExpandWords(tokens []Token) ([]string, error) {
+	var fields []string
+	for _, tok := range tokens {
+		for _, word := range expandBraces(tok) {
+			frags, err := x.expandToken(word)
+			if err != nil {
+				return nil, err
+			}
+			for _, field := range x.splitFields(frags) {
+				fields = append(fields, expandPathname(field, x.dir)...)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// ExpandWord expands a single word without field splitting, as needed for
+// redirect targets and assignment values.
+func (x *Expander) ExpandWord(tok Token) (string, error) {
+	frags, err := x.expandToken(tok)
+	if err != nil {
+		return "", err
+	}
+	return joinFragments(frags), nil
+}
+
+// ExpandPattern expands a word that is matched against rather than used as
+// is, such as a case pattern. Its quoted parts match literally.
+func (x *Expander) ExpandPattern(tok Token) (string, error) {
+	frags, err := x.expandToken(tok)
+	if err != nil {
+		return "", err
+	}
+	return patternOf(frags), nil
+}
+
+func (x *Expander) expandToken(tok Token) ([]fragment, error) {
+	if IsAssignment(tok) && !x.assignment {
+		x.assignment = true
+		defer func() { x.assignment = false }()
+	}
+	tok = x.expandTilde(tok)
+
+	var frags []fragment
+	for _, part := range tok.Parts {
+		switch part.Quote {
+		case SingleQuoted, Escaped:
+			frags = append(frags, fragment{text: part.Text, quoted: true})
+		default:
+			expanded, err := x.expandText(part.Text, part.Quote == DoubleQuoted)
+			if err != nil {
+				return nil, err
+			}
+			frags = append(frags, expanded...)
+		}
+	}
+	return frags, nil
+}
+
+// expandText expands the $ forms in an unquoted or double-quoted run.
+func (x *Expander) expandText(text string, quoted bool) ([]fragment, error) {
+	var frags []fragment
+	var lit strings.Builder
+	noWords := false // "$@" with no parameters, which makes no word at all
+
+	flush := func() {
+		if lit.Len() > 0 {
+			frags = append(frags, fragment{text: lit.String(), quoted: quoted})
+			lit.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		if text[i] == '`' {
+			end := backquoteEnd(text, i+1)
+			if end < 0 {
+				lit.WriteByte(text[i])
+				i++
+				continue
+			}
+			flush()
+			frag, err := x.commandFragment(unescapeBackquoted(text[i+1:end], quoted), quoted)
+			if err != nil {
+				return nil, err
+			}
+			frags = append(frags, frag)
+			i = end + 1
+			continue
+		}
+
+		if text[i] != '$' || i+1 >= len(text) {
+			lit.WriteByte(text[i])
+			i++
+			continue
+		}
+
+		next := text[i+1]
+		switch {
+		case strings.HasPrefix(text[i:], "$((") && isArithmetic(text, i+1):
+			end := closingIndex(text, i+1)
+			flush()
+			value, err := x.Arithmetic(text[i+3 : end-1])
+			if err != nil {
+				return nil, err
+			}
+			frags = append(frags, fragment{text: strconv.FormatInt(value, 10), quoted: quoted, split: !quoted})
+			i = end + 1
+
+		case next == '(':
+			end := closingIndex(text, i+1)
+			if end < 0 {
+				return nil, errBadSubstitution(text[i:])
+			}
+			flush()
+			frag, err := x.commandFragment(text[i+2:end], quoted)
+			if err != nil {
+				return nil, err
+			}
+			frags = append(frags, frag)
+			i = end + 1
+
+		case next == '{':
+			end := closingIndex(text, i+1)
+			if end < 0 {
+				return nil, errBadSubstitution(text[i:])
+			}
+			flush()
+			expanded, err := x.expandBraced(text[i+2:end], quoted)
+			if err != nil {
+				return nil, err
+			}
+			frags = append(frags, expanded...)
+			i = end + 1
+
+		case isNameStart(next):
+			j := i + 1
+			for j < len(text) && isNameChar(text[j]) {
+				j++
+			}
+			flush()
+			frags = append(frags, x.valueFragment(text[i+1:j], quoted))
+			i = j
+
+		case next == '@' || next == '*':
+			flush()
+			elems, _ := x.lookupElements("@", "@")
+			frags = append(frags, x.elementFragments(elems, text[i+1:i+2], quoted)...)
+			noWords = noWords || (next == '@' && len(elems) == 0)
+			i += 2
+
+		case isSpecialParam(next):
+			flush()
+			frags = append(frags, x.valueFragment(text[i+1:i+2], quoted))
+			i += 2
+
+		default:
+			lit.WriteByte('$')
+			i++
+		}
+	}
+	flush()
+
+	if len(frags) == 0 && quoted && !noWords {
+		// "" and "$EMPTY" still make a word
+		frags = append(frags, fragment{quoted: true})
+	}
+	return frags, nil
+}
+
+func (x *Expander) valueFragment(name string, quoted bool) fragment {
+	value, _ := x.vars.LookupVar(name)
+	return fragment{text: value, quoted: quoted, split: !quoted}
+}
+
+// Arithmetic expands the parameters and substitutions in expr and evaluates
+// the result as an integer expression.
+func (x *Expander) Arithmetic(expr string) (int64, error) {
+	frags, err := x.expandOperand(expr, true)
+	if err != nil {
+		return 0, err
+	}
+	return arith.Eval(joinFragments(frags), x.vars)
+}
+
+// isArithmetic reports whether the (( at text[open] is closed by a )) rather
+// than being a command substitution that starts with a subshell.
+func isArithmetic(text string, open int) bool {
+	end := closingIndex(text, open)
+	return end > open+1 && closingIndex(text, open+1) == end-1
+}
+
+// commandFragment runs a command substitution. Trailing newlines are dropped
+// from its output.
+func (x *Expander) commandFragment(src string, quoted bool) (fragment, error) {
+	out, err := x.substitute(src)
+	if err != nil {
+		return fragment{}, err
+	}
+	out = strings.TrimRight(out, "\n")
+	return fragment{text: out, quoted: quoted, split: !quoted}, nil
+}
+
+// unescapeBackquoted removes the backslashes that quote $, ` and \ inside
+// the old-style `...` form, and " as well when it sits in double quotes.
+func unescapeBackquoted(src string, quoted bool) string {
+	special := "$`\\"
+	if quoted {
+		special += `"`
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\\' && i+1 < len(src) && strings.IndexByte(special, src[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(src[i])
+	}
+	return b.String()
+}
+
+/* =========================
+     FIELD SPLITTING
+========================= */
+
+func (x *Expander) splitFields(frags []fragment) [][]fragment {
+	ifs, ok := x.vars.LookupVar("IFS")
+	if !ok {
+		ifs = " \t\n"
+	}
+
+	var fields [][]fragment
+	var current []fragment
+	keep := false // current holds something worth emitting
+
+	emit := func() {
+		fields = append(fields, current)
+		current = nil
+		keep = false
+	}
+
+	for _, frag := range frags {
+		if frag.fieldBreak {
+			if frag.quoted || keep {
+				emit()
+			}
+			continue
+		}
+		if !frag.split || ifs == "" {
+			current = append(current, frag)
+			if frag.quoted || frag.text != "" {
+				keep = true
+			}
+			continue
+		}
+
+		var run strings.Builder
+		afterSpace := false
+		for _, ch := range frag.text {
+			if !strings.ContainsRune(ifs, ch) {
+				run.WriteRune(ch)
+				keep = true
+				afterSpace = false
+				continue
+			}
+			if run.Len() > 0 {
+				current = append(current, fragment{text: run.String()})
+				run.Reset()
+			}
+			if isIFSSpace(ch) {
+				if keep {
+					emit()
+					afterSpace = true
+				}
+				continue
+			}
+			// a non-blank separator always ends a field, even an empty one
+			if !afterSpace {
+				emit()
+			}
+			afterSpace = false
+		}
+		if run.Len() > 0 {
+			current = append(current, fragment{text: run.String()})
+		}
+	}
+
+	if keep {
+		emit()
+	}
+	return fields
+}
+
+func isIFSSpace(ch rune) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n'
+}
+
+func joinFragments(frags []fragment) string {
+	var b strings.Builder
+	for _, f := range frags {
+		b.WriteString(f.text)
+	}
+	return b.String()
+}
+
+// patternOf turns fragments into a pattern for Match, escaping quoted text.
+func patternOf(frags []fragment) string {
+	var b strings.Builder
+	for _, f := range frags {
+		if f.quoted {
+			b.WriteString(QuoteMeta(f.text))
+		} else {
+			b.WriteString(f.text)
+		}
+	}
+	return b.String()
+}
+
+func isNameStart(ch byte) bool {
+	return ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
+
+func isNameChar(ch byte) bool {
+	return isNameStart(ch) || ('0' <= ch && ch <= '9')
+}
+
+func isSpecialParam(ch byte) bool {
+	return ('0' <= ch && ch <= '9') || strings.IndexByte("?#$!@*-", ch) >= 0
+}
+
+// IsAssignment reports whether the word tok has the form NAME=value, with the
+// name and the = unquoted.
+func IsAssignment(tok Token) bool {
+	if tok.Kind != Word || len(tok.Parts) == 0 || tok.Parts[0].Quote != Unquoted {
+		return false
+	}
+	name, _, ok := strings.Cut(tok.Parts[0].Text, "=")
+	return ok && IsName(name)
+}
+
+// IsName reports whether s can name a variable.
+func IsName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
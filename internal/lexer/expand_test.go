@@ -0,0 +1,77 @@
+package lexer
+
+import (
+	"slices"
+	"testing"
+)
+
+type vars struct {
+	values     map[string]string
+	positional []string
+}
+
+func (v *vars) LookupVar(name string) (string, bool) {
+	value, ok := v.values[name]
+	return value, ok
+}
+
+func (v *vars) SetVar(name, value string) error {
+	v.values[name] = value
+	return nil
+}
+
+func (v *vars) LookupArray(name string) ([]string, bool) {
+	if name == "@" {
+		return v.positional, true
+	}
+	return nil, false
+}
+
+func TestExpandWords(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		values     map[string]string
+		positional []string
+		want       []string
+	}{
+		{"plain", "a b", nil, nil, []string{"a", "b"}},
+		{"default IFS", "$v", map[string]string{"v": "  a \t b\nc  "}, nil, []string{"a", "b", "c"}},
+		{"quoted", `"$v"`, map[string]string{"v": " a  b "}, nil, []string{" a  b "}},
+		{"unset", "$none", nil, nil, nil},
+		{"empty quoted", `"$none"`, nil, nil, []string{""}},
+		{"joined to text", "x$v", map[string]string{"v": "a b"}, nil, []string{"xa", "b"}},
+		{"custom IFS", "$v", map[string]string{"v": "a:b::c", "IFS": ":"}, nil, []string{"a", "b", "", "c"}},
+		{"trailing IFS", "$v", map[string]string{"v": "a:b:", "IFS": ":"}, nil, []string{"a", "b"}},
+		{"IFS space and colon", "$v", map[string]string{"v": " a : b ", "IFS": " :"}, nil, []string{"a", "b"}},
+		{"empty IFS", "$v", map[string]string{"v": "a b", "IFS": ""}, nil, []string{"a b"}},
+		{"quoted at", `"$@"`, nil, []string{"a b", "", "c"}, []string{"a b", "", "c"}},
+		{"quoted at no args", `"$@"`, nil, nil, nil},
+		{"quoted at with text", `x"$@"y`, nil, []string{"a", "b"}, []string{"xa", "by"}},
+		{"unquoted at", "$@", nil, []string{"a b", "", "c"}, []string{"a", "b", "c"}},
+		{"quoted star", `"$*"`, nil, []string{"a", "b"}, []string{"a b"}},
+		{"quoted star IFS", `"$*"`, map[string]string{"IFS": ":"}, []string{"a", "b"}, []string{"a:b"}},
+		{"braces", "a{1,2}b", nil, nil, []string{"a1b", "a2b"}},
+		{"single quotes", `'$v'`, map[string]string{"v": "x"}, nil, []string{"$v"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string]string{}
+			for name, value := range tt.values {
+				values[name] = value
+			}
+			x := NewExpander(&vars{values: values, positional: tt.positional}, ".", nil)
+			tokens, err := Tokenize(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := x.ExpandWords(tokens[:len(tokens)-1])
+			if err != nil {
+				t.Fatalf("ExpandWords(%s): %v", tt.line, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ExpandWords(%s) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package lexer
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+/* =========================
+    PATHNAME EXPANSION
+========================= */
+
+// expandPathname globs an unquoted field in dir. A field with no matches, or
+// with no unquoted pattern characters, is kept as it is.
+func expandPathname(field []fragment, dir string) []string {
+	pattern := patternOf(field)
+	if !HasMeta(pattern) {
+		return []string{joinFragments(field)}
+	}
+
+	matches := glob(pattern, dir)
+	if len(matches) == 0 {
+		return []string{joinFragments(field)}
+	}
+	return matches
+}
+
+// glob matches pattern one path component at a time, so * and ? never match
+// a slash. Hidden files only match when the component starts with a dot. A
+// relative pattern is looked up in dir, but its matches stay relative.
+func glob(pattern, dir string) []string {
+	at := func(path string) string {
+		if path == "" {
+			path = "."
+		}
+		if strings.HasPrefix(path, "/") {
+			return path
+		}
+		return joinPath(dir, path)
+	}
+
+	segments := strings.Split(pattern, "/")
+	matches := []string{""}
+	if strings.HasPrefix(pattern, "/") {
+		matches = []string{"/"}
+		segments = segments[1:]
+	}
+
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		var next []string
+
+		for _, base := range matches {
+			switch {
+			case seg == "":
+				// a trailing slash only keeps directories
+				if last && isDir(at(base)) {
+					next = append(next, base+"/")
+				} else if !last {
+					next = append(next, base)
+				}
+
+			case !HasMeta(seg):
+				path := joinPath(base, unescapePattern(seg))
+				if exists(at(path), last) {
+					next = append(next, path)
+				}
+
+			default:
+				entries, err := os.ReadDir(at(base))
+				if err != nil {
+					continue
+				}
+				for _, entry := range entries {
+					name := entry.Name()
+					if strings.HasPrefix(name, ".") && !strings.HasPrefix(seg, ".") && !strings.HasPrefix(seg, `\.`) {
+						continue
+					}
+					if !Match(seg, name) {
+						continue
+					}
+					path := joinPath(base, name)
+					if exists(at(path), last) {
+						next = append(next, path)
+					}
+				}
+			}
+		}
+
+		matches = next
+		if len(matches) == 0 {
+			return nil
+		}
+	}
+
+	sort.Strings(matches)
+	return matches
+}
+
+func joinPath(base, name string) string {
+	if base == "" {
+		return name
+	}
+	if strings.HasSuffix(base, "/") {
+		return base + name
+	}
+	return base + "/" + name
+}
+
+// exists checks the final component for any file and the ones before it for
+// a directory to descend into.
+func exists(path string, last bool) bool {
+	if last {
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+	return isDir(path)
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func unescapePattern(seg string) string {
+	if !strings.Contains(seg, `\`) {
+		return seg
+	}
+	var b strings.Builder
+	for i := 0; i < len(seg); i++ {
+		if seg[i] == '\\' && i+1 < len(seg) {
+			i++
+		}
+		b.WriteByte(seg[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package lexer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExpandWordsGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.txt", "a.txt", ".hidden.txt", "c.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"*.txt", []string{"a.txt", "b.txt"}},
+		{".*.txt", []string{".hidden.txt"}},
+		{`"*.txt"`, []string{"*.txt"}},
+		{"*.none", []string{"*.none"}},
+		{"$v", []string{"a.txt", "b.txt"}},
+	}
+	for _, tt := range tests {
+		x := NewExpander(&vars{values: map[string]string{"v": "*.txt"}}, dir, nil)
+		tokens, err := Tokenize(tt.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := x.ExpandWords(tokens[:len(tokens)-1])
+		if err != nil {
+			t.Fatalf("ExpandWords(%s): %v", tt.line, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ExpandWords(%s) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
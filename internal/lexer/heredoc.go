@@ -0,0 +1,104 @@
+package lexer
+
+import (
+	"strings"
+)
+
+/* =========================
+      HERE-DOCUMENTS
+========================= */
+
+func isHeredocOp(op string) bool {
+	op = strings.TrimLeft(op, "0123456789")
+	return op == "<<" || op == "<<-"
+}
+
+// readHeredocs reads the bodies of the pending << operators, in order, from
+// the lines that follow the newline just consumed.
+func (s *scanner) readHeredocs(tokens []Token, pending []int) error {
+	for _, i := range pending {
+		if i+1 >= len(tokens) || tokens[i+1].Kind != Word {
+			// missing delimiter: the parser reports it
+			continue
+		}
+		op, delimTok := tokens[i], tokens[i+1]
+		delim := delimTok.Value
+		stripTabs := strings.HasSuffix(op.Value, "-")
+
+		var body strings.Builder
+		for {
+			if s.off >= len(s.src) {
+				return &IncompleteError{Pos: op.Pos, What: "here-document delimiter `" + delim + "'"}
+			}
+
+			line := s.src[s.off:]
+			if end := strings.IndexByte(line, '\n'); end >= 0 {
+				line = line[:end]
+			}
+			for end := s.off + len(line); s.off < end; {
+				s.next()
+			}
+			s.next() // the newline, if any
+
+			if stripTabs {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == delim {
+				break
+			}
+			body.WriteString(line)
+			body.WriteByte('\n')
+		}
+
+		tokens[i].Body = heredocBody(body.String(), delimTok.Quoted(), op.Pos)
+	}
+	return nil
+}
+
+// heredocBody turns the text of a here-document into a word. With a quoted
+// delimiter the text stays literal; otherwise it expands like a double-quoted
+// string, except that a backslash only escapes $, ` and \.
+func heredocBody(text string, literal bool, pos Position) *Token {
+	tok := &Token{Kind: Word, Value: text, Pos: pos}
+	if literal {
+		tok.Parts = []Part{{Text: text, Quote: SingleQuoted}}
+		return tok
+	}
+
+	add := func(quote Quote, text string) {
+		n := len(tok.Parts)
+		if n > 0 && tok.Parts[n-1].Quote == quote {
+			tok.Parts[n-1].Text += text
+			return
+		}
+		tok.Parts = append(tok.Parts, Part{Text: text, Quote: quote})
+	}
+
+	add(DoubleQuoted, "")
+	for i := 0; i < len(text); i++ {
+		switch ch := text[i]; {
+		case ch == '\\' && i+1 < len(text) && strings.IndexByte("$`\\", text[i+1]) >= 0:
+			add(Escaped, text[i+1:i+2])
+			i++
+		case ch == '\\' && i+1 < len(text) && text[i+1] == '\n':
+			i++
+		case ch == '$' && i+1 < len(text) && (text[i+1] == '{' || text[i+1] == '('):
+			end := closingIndex(text, i+1)
+			if end < 0 {
+				end = len(text) - 1
+			}
+			add(DoubleQuoted, text[i:end+1])
+			i = end
+		case ch == '`':
+			end := backquoteEnd(text, i+1)
+			if end < 0 {
+				end = len(text) - 1
+			}
+			add(DoubleQuoted, text[i:end+1])
+			i = end
+		default:
+			add(DoubleQuoted, text[i:i+1])
+		}
+	}
+	return tok
+}
@@ -0,0 +1,397 @@
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/* =========================
+   PARAMETER EXPANSION
+========================= */
+
+// expandBraced handles the text between ${ and }.
+func (x *Expander) expandBraced(inner string, quoted bool) ([]fragment, error) {
+	if len(inner) > 1 && inner[0] == '#' {
+		if name, sub, rest, ok := splitSubscript(inner[1:]); ok && rest == "" {
+			elems, err := x.lookupElements(name, sub)
+			if err != nil {
+				return nil, err
+			}
+			length := len(elems)
+			if !isAllElements(sub) {
+				length = utf8.RuneCountInString(strings.Join(elems, ""))
+			}
+			return []fragment{{text: strconv.Itoa(length), quoted: quoted, split: !quoted}}, nil
+		}
+
+		name := inner[1:]
+		if paramNameLen(name) != len(name) {
+			return nil, errBadSubstitution("${" + inner + "}")
+		}
+		value, _ := x.vars.LookupVar(name)
+		length := strconv.Itoa(utf8.RuneCountInString(value))
+		return []fragment{{text: length, quoted: quoted, split: !quoted}}, nil
+	}
+
+	var name, rest, value string
+	var set bool
+	if arrayName, sub, after, ok := splitSubscript(inner); ok {
+		elems, err := x.lookupElements(arrayName, sub)
+		if err != nil {
+			return nil, err
+		}
+		if after == "" && isAllElements(sub) {
+			return x.elementFragments(elems, sub, quoted), nil
+		}
+		// an element can't be assigned to through ${a[i]:=word}
+		name, rest = inner[:len(inner)-len(after)], after
+		value, set = strings.Join(elems, " "), len(elems) > 0
+	} else {
+		n := paramNameLen(inner)
+		if n == 0 {
+			return nil, errBadSubstitution("${" + inner + "}")
+		}
+		name, rest = inner[:n], inner[n:]
+		if (name == "@" || name == "*") && rest == "" {
+			// $* joins the same positional parameters as $@
+			elems, _ := x.lookupElements("@", "@")
+			return x.elementFragments(elems, name, quoted), nil
+		}
+		value, set = x.vars.LookupVar(name)
+	}
+
+	if rest == "" {
+		return []fragment{{text: value, quoted: quoted, split: !quoted}}, nil
+	}
+
+	op, word := splitParamOp(rest)
+	if op == "" {
+		return nil, errBadSubstitution("${" + inner + "}")
+	}
+
+	// with a colon, an empty value counts as unset
+	if strings.HasPrefix(op, ":") {
+		set = set && value != ""
+		op = op[1:]
+	}
+
+	switch op {
+	case "-":
+		if set {
+			break
+		}
+		return x.expandOperand(word, quoted)
+
+	case "=":
+		if set {
+			break
+		}
+		frags, err := x.expandOperand(word, quoted)
+		if err != nil {
+			return nil, err
+		}
+		if !IsName(name) {
+			return nil, fmt.Errorf("$%s: cannot assign in this way", name)
+		}
+		value = joinFragments(frags)
+		if err := x.vars.SetVar(name, value); err != nil {
+			return nil, err
+		}
+
+	case "?":
+		if set {
+			break
+		}
+		frags, err := x.expandOperand(word, true)
+		if err != nil {
+			return nil, err
+		}
+		msg := joinFragments(frags)
+		if msg == "" {
+			msg = "parameter null or not set"
+		}
+		return nil, fmt.Errorf("%s: %s", name, msg)
+
+	case "+":
+		if !set {
+			return nil, nil
+		}
+		return x.expandOperand(word, quoted)
+
+	case "#", "##", "%", "%%":
+		pattern, err := x.expandPattern(word)
+		if err != nil {
+			return nil, err
+		}
+		value = trimPattern(value, pattern, op)
+
+	case "/", "//", "/#", "/%":
+		patWord, replWord, _ := splitUnquoted(word, '/')
+		pattern, err := x.expandPattern(patWord)
+		if err != nil {
+			return nil, err
+		}
+		frags, err := x.expandOperand(replWord, true)
+		if err != nil {
+			return nil, err
+		}
+		value = replacePattern(value, pattern, joinFragments(frags), op)
+	}
+
+	return []fragment{{text: value, quoted: quoted, split: !quoted}}, nil
+}
+
+// splitSubscript splits NAME[sub]rest into its pieces. ok is false when text
+// does not start with a subscripted name.
+func splitSubscript(text string) (name, sub, rest string, ok bool) {
+	n := paramNameLen(text)
+	if n == 0 || !IsName(text[:n]) || n >= len(text) || text[n] != '[' {
+		return "", "", "", false
+	}
+	end := strings.IndexByte(text[n:], ']')
+	if end < 0 {
+		return "", "", "", false
+	}
+	return text[:n], text[n+1 : n+end], text[n+end+1:], true
+}
+
+func isAllElements(sub string) bool {
+	return sub == "@" || sub == "*"
+}
+
+// lookupElements returns the elements name[sub] selects: all of them for @
+// and *, otherwise the one at the arithmetic index sub, counting from the end
+// when negative. A plain variable acts as an array of one element.
+func (x *Expander) lookupElements(name, sub string) ([]string, error) {
+	var elems []string
+	found := false
+	if arrays, ok := x.vars.(Arrays); ok {
+		elems, found = arrays.LookupArray(name)
+	}
+	if !found {
+		if value, ok := x.vars.LookupVar(name); ok {
+			elems = []string{value}
+		}
+	}
+	if isAllElements(sub) {
+		return elems, nil
+	}
+
+	index, err := x.Arithmetic(sub)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 {
+		index += int64(len(elems))
+	}
+	if index < 0 || index >= int64(len(elems)) {
+		return nil, nil
+	}
+	return elems[index : index+1], nil
+}
+
+// elementFragments expands ${a[@]} and ${a[*]}. Each element becomes its own
+// field, except in "${a[*]}", which joins them with the first IFS character.
+func (x *Expander) elementFragments(elems []string, sub string, quoted bool) []fragment {
+	if quoted && sub == "*" {
+		sep := " "
+		if ifs, ok := x.vars.LookupVar("IFS"); ok {
+			sep = ""
+			if ifs != "" {
+				sep = ifs[:1]
+			}
+		}
+		return []fragment{{text: strings.Join(elems, sep), quoted: true}}
+	}
+
+	var frags []fragment
+	for i, elem := range elems {
+		if i > 0 {
+			frags = append(frags, fragment{text: " ", quoted: quoted, fieldBreak: true})
+		}
+		frags = append(frags, fragment{text: elem, quoted: quoted, split: !quoted})
+	}
+	return frags
+}
+
+// expandOperand expands the word on the right of a ${NAME<op>word} form. The
+// result of an unquoted operand is subject to field splitting like any other
+// expansion.
+func (x *Expander) expandOperand(word string, quoted bool) ([]fragment, error) {
+	s := &scanner{src: word, line: 1, col: 1}
+	tok, err := s.scanWord(func(rune) bool { return false })
+	if err != nil {
+		return nil, err
+	}
+
+	frags, err := x.expandToken(tok)
+	if err != nil {
+		return nil, err
+	}
+	for i := range frags {
+		if quoted {
+			frags[i].quoted = true
+		}
+		frags[i].split = !frags[i].quoted
+	}
+	return frags, nil
+}
+
+func (x *Expander) expandPattern(word string) (string, error) {
+	s := &scanner{src: word, line: 1, col: 1}
+	tok, err := s.scanWord(func(rune) bool { return false })
+	if err != nil {
+		return "", err
+	}
+	return x.ExpandPattern(tok)
+}
+
+func trimPattern(value, pattern, op string) string {
+	bounds := runeBoundaries(value)
+
+	switch op {
+	case "#":
+		for _, i := range bounds {
+			if Match(pattern, value[:i]) {
+				return value[i:]
+			}
+		}
+	case "##":
+		for k := len(bounds) - 1; k >= 0; k-- {
+			if Match(pattern, value[:bounds[k]]) {
+				return value[bounds[k]:]
+			}
+		}
+	case "%":
+		for k := len(bounds) - 1; k >= 0; k-- {
+			if Match(pattern, value[bounds[k]:]) {
+				return value[:bounds[k]]
+			}
+		}
+	case "%%":
+		for _, i := range bounds {
+			if Match(pattern, value[i:]) {
+				return value[:i]
+			}
+		}
+	}
+	return value
+}
+
+func replacePattern(value, pattern, repl, op string) string {
+	if pattern == "" {
+		return value
+	}
+	bounds := runeBoundaries(value)
+
+	var out strings.Builder
+	last := 0
+	for k := 0; k < len(bounds); k++ {
+		start := bounds[k]
+		if start < last || (op == "/#" && start != 0) {
+			continue
+		}
+
+		end := -1
+		for e := len(bounds) - 1; e >= k; e-- {
+			if op == "/%" && bounds[e] != len(value) {
+				continue
+			}
+			if Match(pattern, value[start:bounds[e]]) {
+				end = bounds[e]
+				break
+			}
+		}
+		if end < 0 || (end == start && op != "/#" && op != "/%") {
+			continue
+		}
+
+		out.WriteString(value[last:start])
+		out.WriteString(repl)
+		last = end
+		if op != "//" {
+			break
+		}
+	}
+	out.WriteString(value[last:])
+	return out.String()
+}
+
+// runeBoundaries lists every index in s that starts a rune, plus len(s).
+func runeBoundaries(s string) []int {
+	bounds := make([]int, 0, len(s)+1)
+	for i := range s {
+		bounds = append(bounds, i)
+	}
+	return append(bounds, len(s))
+}
+
+// paramNameLen returns how much of s is a parameter name: a variable name,
+// a positional number or a single special character.
+func paramNameLen(s string) int {
+	if s == "" {
+		return 0
+	}
+	switch {
+	case isNameStart(s[0]):
+		n := 1
+		for n < len(s) && isNameChar(s[n]) {
+			n++
+		}
+		return n
+	case '0' <= s[0] && s[0] <= '9':
+		n := 1
+		for n < len(s) && '0' <= s[n] && s[n] <= '9' {
+			n++
+		}
+		return n
+	case isSpecialParam(s[0]):
+		return 1
+	}
+	return 0
+}
+
+func splitParamOp(rest string) (op, word string) {
+	ops := []string{":-", ":=", ":?", ":+", "-", "=", "?", "+", "##", "#", "%%", "%", "//", "/#", "/%", "/"}
+	for _, candidate := range ops {
+		if strings.HasPrefix(rest, candidate) {
+			return candidate, rest[len(candidate):]
+		}
+	}
+	return "", ""
+}
+
+// splitUnquoted splits word at the first sep that is not quoted or escaped.
+func splitUnquoted(word string, sep byte) (before, after string, found bool) {
+	for i := 0; i < len(word); i++ {
+		switch word[i] {
+		case '\\':
+			i++
+		case '\'':
+			if end := strings.IndexByte(word[i+1:], '\''); end >= 0 {
+				i += end + 1
+			}
+		case '"':
+			for i++; i < len(word) && word[i] != '"'; i++ {
+				if word[i] == '\\' {
+					i++
+				}
+			}
+		case '$':
+			if i+1 < len(word) && (word[i+1] == '{' || word[i+1] == '(') {
+				if end := closingIndex(word, i+1); end >= 0 {
+					i = end
+				}
+			}
+		case sep:
+			return word[:i], word[i+1:], true
+		}
+	}
+	return word, "", false
+}
+
+func errBadSubstitution(text string) error {
+	return fmt.Errorf("%s: bad substitution", text)
+}
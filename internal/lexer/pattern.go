@@ -0,0 +1,182 @@
+package lexer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/* =========================
+     PATTERN MATCHING
+========================= */
+
+// Match reports whether name matches the shell pattern. The special
+// characters are *, ? and [...]; a backslash makes the next one literal.
+//
+// After a mismatch it goes back to just past the last * and lets that *
+// take one more character of name. The stars before it never need to take
+// more, so matching is linear rather than exponential in the stars.
+func Match(pattern, name string) bool {
+	star := false
+	var starPattern, starName string
+	for {
+		if pattern != "" && pattern[0] == '*' {
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			star, starPattern, starName = true, pattern, name
+			continue
+		}
+		if pattern == "" && name == "" {
+			return true
+		}
+		if pattern != "" {
+			if rest, restName, ok := matchOne(pattern, name); ok {
+				pattern, name = rest, restName
+				continue
+			}
+		}
+		if !star || starName == "" {
+			return false
+		}
+		_, n := utf8.DecodeRuneInString(starName)
+		starName = starName[n:]
+		pattern, name = starPattern, starName
+	}
+}
+
+// matchOne matches the first character of name against the part of the
+// pattern that stands for one character, other than *. It returns what is
+// left of both.
+func matchOne(pattern, name string) (restPattern, restName string, ok bool) {
+	if name == "" {
+		return "", "", false
+	}
+	ch, size := utf8.DecodeRuneInString(pattern)
+	r, n := utf8.DecodeRuneInString(name)
+
+	switch ch {
+	case '?':
+		return pattern[size:], name[n:], true
+
+	case '[':
+		matched, rest, closed := matchClass(pattern[size:], r)
+		if !closed {
+			// no closing bracket: the [ is an ordinary character
+			return pattern[size:], name[n:], r == '['
+		}
+		return rest, name[n:], matched
+
+	case '\\':
+		if len(pattern) > size {
+			pattern = pattern[size:]
+		}
+		// a trailing backslash stands for itself
+		ch, size = utf8.DecodeRuneInString(pattern)
+	}
+	return pattern[size:], name[n:], r == ch
+}
+
+// HasMeta reports whether the pattern contains an unescaped special character.
+func HasMeta(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// QuoteMeta escapes every character Match would treat as special.
+func QuoteMeta(text string) string {
+	if !strings.ContainsAny(text, `*?[]\`) {
+		return text
+	}
+	var b strings.Builder
+	for _, ch := range text {
+		if strings.ContainsRune(`*?[]\`, ch) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
+
+// matchClass matches r against the bracket expression that starts right after
+// the opening [. It returns the pattern that follows the closing ].
+func matchClass(pattern string, r rune) (matched bool, rest string, ok bool) {
+	negate := false
+	if len(pattern) > 0 && (pattern[0] == '!' || pattern[0] == '^') {
+		negate = true
+		pattern = pattern[1:]
+	}
+
+	first := true
+	for {
+		if pattern == "" {
+			return false, "", false
+		}
+		if pattern[0] == ']' && !first {
+			return matched != negate, pattern[1:], true
+		}
+		first = false
+
+		if strings.HasPrefix(pattern, "[:") {
+			if end := strings.Index(pattern[2:], ":]"); end >= 0 {
+				if matchNamedClass(pattern[2:2+end], r) {
+					matched = true
+				}
+				pattern = pattern[end+4:]
+				continue
+			}
+		}
+
+		lo, size := classChar(pattern)
+		pattern = pattern[size:]
+		hi := lo
+		if len(pattern) > 1 && pattern[0] == '-' && pattern[1] != ']' {
+			var n int
+			hi, n = classChar(pattern[1:])
+			pattern = pattern[1+n:]
+		}
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+}
+
+func classChar(pattern string) (rune, int) {
+	if pattern[0] == '\\' && len(pattern) > 1 {
+		r, n := utf8.DecodeRuneInString(pattern[1:])
+		return r, n + 1
+	}
+	return utf8.DecodeRuneInString(pattern)
+}
+
+func matchNamedClass(name string, r rune) bool {
+	switch name {
+	case "alpha":
+		return unicode.IsLetter(r)
+	case "digit":
+		return unicode.IsDigit(r)
+	case "alnum":
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	case "upper":
+		return unicode.IsUpper(r)
+	case "lower":
+		return unicode.IsLower(r)
+	case "space":
+		return unicode.IsSpace(r)
+	case "blank":
+		return r == ' ' || r == '\t'
+	case "punct":
+		return unicode.IsPunct(r) || unicode.IsSymbol(r)
+	case "xdigit":
+		return strings.ContainsRune("0123456789abcdefABCDEF", r)
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"*.go", "main.go", true},
+		{"*.go", "main.go.txt", false},
+		{"**b", "aab", true},
+		{"?", "é", true},
+		{"??", "a", false},
+		{"[abc]x", "bx", true},
+		{"[abc]x", "dx", false},
+		{"[a-c]", "b", true},
+		{"[!a-c]", "b", false},
+		{"[^a-c]", "d", true},
+		{"[]]", "]", true},
+		{"[a-]", "-", true},
+		{"[[:digit:]]*", "1st", true},
+		{"[[:alpha:]]", "1", false},
+		{"[abc", "[abc", true},
+		{"[abc", "a", false},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`a\`, `a\`, true},
+		{"*a*b*c", "xaybzc", true},
+		{"*a*b*c", "xaybzcd", false},
+		{"a*b?c*", "aXXbYcZZ", true},
+		{"*[0-9]", "abc7", true},
+		{"*\\*", "ab*", true},
+		{"*\\*", "a*b", false},
+		{"*x", "xxxy", false},
+		// one more *a used to take four times as long
+		{"*a*a*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 60), false},
+		{"*a*a*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 60) + "b", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package lexer
+
+import (
+	"os/user"
+	"strings"
+)
+
+/* =========================
+     TILDE EXPANSION
+========================= */
+
+// expandTilde replaces tilde prefixes with the directories they name. The
+// directory goes in as a quoted part, so it is neither split nor globbed. In
+// an assignment such as PATH=~/bin:~/go/bin a tilde may also follow the =
+// or any :, including a : in the operand of a ${...} in the assignment. The
+// text of $(...), ${...} and backquotes is left to the expansions of those.
+func (x *Expander) expandTilde(tok Token) Token {
+	if len(tok.Parts) == 0 {
+		return tok
+	}
+
+	eq := -1
+	if first := tok.Parts[0]; first.Quote == Unquoted {
+		if i := strings.IndexByte(first.Text, '='); i > 0 && IsName(first.Text[:i]) {
+			eq = i
+		}
+	}
+	assignment := eq >= 0 || x.assignment
+
+	var parts []Part
+	changed := false
+	for i, part := range tok.Parts {
+		if part.Quote != Unquoted {
+			parts = append(parts, part)
+			continue
+		}
+
+		text := part.Text
+		last := i == len(tok.Parts)-1
+		from := 0
+		for j := 0; j < len(text); j++ {
+			switch {
+			case text[j] == '$' && j+1 < len(text) && (text[j+1] == '{' || text[j+1] == '('):
+				if end := closingIndex(text, j+1); end >= 0 {
+					j = end
+				}
+				continue
+			case text[j] == '`':
+				if end := backquoteEnd(text, j+1); end >= 0 {
+					j = end
+				}
+				continue
+			case text[j] != '~':
+				continue
+			}
+			atStart := i == 0 && j == 0
+			afterSep := assignment && j > 0 && (text[j-1] == ':' || (i == 0 && j == eq+1))
+			if !atStart && !afterSep {
+				continue
+			}
+
+			end := j + 1
+			for end < len(text) && text[end] != '/' && !(assignment && text[end] == ':') {
+				end++
+			}
+			if end == len(text) && !last {
+				// the prefix runs into quoted text, which disables it
+				continue
+			}
+
+			dir, ok := x.tildeDir(text[j+1 : end])
+			if !ok {
+				continue
+			}
+			if j > from {
+				parts = append(parts, Part{Text: text[from:j], Quote: Unquoted})
+			}
+			parts = append(parts, Part{Text: dir, Quote: SingleQuoted})
+			from = end
+			j = end - 1
+			changed = true
+		}
+		if from < len(text) {
+			parts = append(parts, Part{Text: text[from:], Quote: Unquoted})
+		}
+	}
+
+	if !changed {
+		return tok
+	}
+	var value strings.Builder
+	for _, p := range parts {
+		value.WriteString(p.Text)
+	}
+	tok.Parts, tok.Value = parts, value.String()
+	return tok
+}
+
+// tildeDir resolves what follows a ~: nothing for $HOME, + and - for $PWD
+// and $OLDPWD, or a login name.
+func (x *Expander) tildeDir(name string) (string, bool) {
+	switch name {
+	case "":
+		if home, ok := x.vars.LookupVar("HOME"); ok {
+			return home, true
+		}
+		u, err := user.Current()
+		if err != nil {
+			return "", false
+		}
+		return u.HomeDir, true
+	case "+":
+		return x.vars.LookupVar("PWD")
+	case "-":
+		return x.vars.LookupVar("OLDPWD")
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", false
+	}
+	return u.HomeDir, true
+}
@@ -0,0 +1,46 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandTilde(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"~", "/home/u"},
+		{"~/x", "/home/u/x"},
+		{"a~", "a~"},
+		{"'~'", "~"},
+		{"~+", "/work"},
+		{"X=~/a:~/b", "X=/home/u/a:/home/u/b"},
+		{"X=a:~", "X=a:/home/u"},
+		{"X=$(echo a:~/x)", "X=a:~/x"},
+		{"X=`echo a:~/x`:~", "X=a:~/x:/home/u"},
+		{"X=${Y:-a:~/z}", "X=a:/home/u/z"},
+		{"${Y:-a:~/z}", "a:~/z"},
+		{"${Y:-~/z}", "/home/u/z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			values := map[string]string{"HOME": "/home/u", "PWD": "/work"}
+			// the substitution echoes its arguments back
+			x := NewExpander(&vars{values: values}, ".", func(src string) (string, error) {
+				return strings.TrimPrefix(src, "echo ") + "\n", nil
+			})
+			tokens, err := Tokenize(tt.word)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := x.ExpandWord(tokens[0])
+			if err != nil {
+				t.Fatalf("ExpandWord(%s): %v", tt.word, err)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandWord(%s) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
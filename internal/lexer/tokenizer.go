@@ -1,86 +1,511 @@
 package lexer
 
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+/* =========================
+         TOKENS
+========================= */
+
+type Kind int
+
+const (
+	Word Kind = iota
+	Operator
+	Newline
+	EOF
+	Arithmetic // a (( expr )) command; Value holds expr
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Word:
+		return "word"
+	case Operator:
+		return "operator"
+	case Newline:
+		return "newline"
+	case Arithmetic:
+		return "arithmetic"
+	default:
+		return "EOF"
+	}
+}
+
+// Quote records how a piece of a word was written in the source.
+type Quote int
+
+const (
+	Unquoted Quote = iota
+	SingleQuoted
+	DoubleQuoted
+	Escaped
+)
+
+type Position struct {
+	Offset int // byte offset into the input
+	Line   int // 1-based
+	Column int // 1-based, counted in runes
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Part is a run of a word that shares the same quoting.
+type Part struct {
+	Text  string
+	Quote Quote
+}
+
+type Token struct {
+	Kind  Kind
+	Value string // text after quote removal, or the operator itself
+	Parts []Part // only set for words
+	Pos   Position
+	// Body is the here-document read for a << or <<- operator.
+	Body *Token
+}
+
+// Quoted reports whether any part of the word was quoted or escaped.
+func (t Token) Quoted() bool {
+	for _, p := range t.Parts {
+		if p.Quote != Unquoted {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Token) IsOperator(op string) bool {
+	return t.Kind == Operator && t.Value == op
+}
+
+// IsReserved reports whether t is the reserved word w. Reserved words only
+// count when written without quotes; the parser decides whether they stand
+// where a command starts.
+func (t Token) IsReserved(w string) bool {
+	return t.Kind == Word && t.Value == w && !t.Quoted()
+}
+
+func (t Token) String() string {
+	switch t.Kind {
+	case Newline, EOF:
+		return "newline"
+	default:
+		return t.Value
+	}
+}
+
 /* =========================
        TOKENIZER
 ========================= */
 
-func Tokenize(line string) []string {
-	const (
-		normal = iota
-		singleQuote
-		doubleQuote
-		escape
-	)
-
-	state := normal
-	prevState := normal
-
-	var tokens []string
-	var token string
-
-	for _, ch := range line {
-		switch state {
-
-		case normal:
-			switch ch {
-			case '\\':
-				prevState = normal
-				state = escape
-			case '|':
-				if token != "" {
-					tokens = append(tokens, token)
-					token = ""
-				}
-				tokens = append(tokens, "|")
-			case ' ':
-				if token != "" {
-					tokens = append(tokens, token)
-					token = ""
+type scanner struct {
+	src  string
+	off  int
+	line int
+	col  int
+}
+
+func Tokenize(line string) ([]Token, error) {
+	s := &scanner{src: line, line: 1, col: 1}
+
+	var tokens []Token
+	var pending []int // << operators whose body starts after the next newline
+	commandStart := true
+	forStart := false // just after a for that starts a command, as in for ((
+	for {
+		s.skipBlanks()
+		pos := s.pos()
+
+		ch, ok := s.peek()
+		switch {
+		case !ok:
+			if err := s.readHeredocs(tokens, pending); err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, Token{Kind: EOF, Pos: pos})
+			return tokens, nil
+
+		case ch == '\n':
+			s.next()
+			tokens = append(tokens, Token{Kind: Newline, Value: "\n", Pos: pos})
+			commandStart, forStart = true, false
+			if err := s.readHeredocs(tokens, pending); err != nil {
+				return nil, err
+			}
+			pending = nil
+
+		case (commandStart || forStart) && strings.HasPrefix(s.src[s.off:], "((") && isArithmetic(s.src, s.off):
+			end := closingIndex(s.src, s.off)
+			expr := s.src[s.off+2 : end-1]
+			for s.off <= end {
+				s.next()
+			}
+			tokens = append(tokens, Token{Kind: Arithmetic, Value: expr, Pos: pos})
+			commandStart, forStart = false, false
+
+		case isOperatorStart(ch):
+			op := s.scanOperator("", pos)
+			if isHeredocOp(op.Value) {
+				pending = append(pending, len(tokens))
+			}
+			tokens = append(tokens, op)
+			commandStart, forStart = true, false
+
+		default:
+			tok, err := s.scanWord(isWordEnd)
+			if err != nil {
+				return nil, err
+			}
+			if next, ok := s.peek(); ok && (next == '>' || next == '<') && isIONumber(tok) {
+				op := s.scanOperator(tok.Value, pos)
+				if isHeredocOp(op.Value) {
+					pending = append(pending, len(tokens))
 				}
-			case '\'':
-				state = singleQuote
-			case '"':
-				state = doubleQuote
+				tokens = append(tokens, op)
+				continue
+			}
+			tokens = append(tokens, tok)
+			forStart = commandStart && tok.IsReserved("for")
+			commandStart = commandStart && opensCommand(tok)
+		}
+	}
+}
+
+// opensCommand reports whether a word at the start of a command is a
+// reserved word after which another command starts, as in if ((x)).
+func opensCommand(tok Token) bool {
+	for _, w := range []string{"if", "then", "elif", "else", "while", "until", "do", "{"} {
+		if tok.IsReserved(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// operators lists every operator, longest first so that scanOperator takes
+// the longest match.
+var operators = []string{
+	"<<<", "<<-", "&>>", ";;&",
+	"&&", "||", ";;", ";&", "<<", ">>", "<&", ">&", "<>", ">|", "&>",
+	"<", ">", "|", "&", ";", "(", ")",
+}
+
+func (s *scanner) scanOperator(ioNumber string, pos Position) Token {
+	rest := s.src[s.off:]
+	op := rest[:1]
+	for _, candidate := range operators {
+		if strings.HasPrefix(rest, candidate) {
+			op = candidate
+			break
+		}
+	}
+	for end := s.off + len(op); s.off < end; {
+		s.next()
+	}
+
+	return Token{Kind: Operator, Value: ioNumber + op, Pos: pos}
+}
+
+// scanWord reads one word, stopping at the first unquoted rune for which
+// stop returns true.
+func (s *scanner) scanWord(stop func(rune) bool) (Token, error) {
+	tok := Token{Kind: Word, Pos: s.pos()}
+
+	add := func(quote Quote, text string) {
+		n := len(tok.Parts)
+		if n > 0 && tok.Parts[n-1].Quote == quote {
+			tok.Parts[n-1].Text += text
+			return
+		}
+		tok.Parts = append(tok.Parts, Part{Text: text, Quote: quote})
+	}
+
+	for {
+		ch, ok := s.peek()
+		if !ok || stop(ch) {
+			break
+		}
+		start := s.pos()
+		s.next()
+
+		switch ch {
+		case '\\':
+			next, ok := s.next()
+			switch {
+			case !ok:
+			case next == '\n':
+				// line continuation
 			default:
-				token += string(ch)
+				add(Escaped, string(next))
+			}
+
+		case '\'':
+			text, ok := s.scanUntil('\'')
+			if !ok {
+				return Token{}, unterminated('\'', start)
+			}
+			add(SingleQuoted, text)
+
+		case '"':
+			if err := s.scanDoubleQuoted(start, add); err != nil {
+				return Token{}, err
 			}
 
-		case singleQuote:
-			if ch == '\'' {
-				state = normal
-			} else {
-				token += string(ch)
+		case '$':
+			raw, err := s.scanDollar(start)
+			if err != nil {
+				return Token{}, err
 			}
+			add(Unquoted, raw)
 
-		case doubleQuote:
-			switch ch {
-			case '\\':
-				prevState = doubleQuote
-				state = escape
-			case '"':
-				state = normal
+		case '`':
+			raw, err := s.scanBackquote(start)
+			if err != nil {
+				return Token{}, err
+			}
+			add(Unquoted, raw)
+
+		default:
+			add(Unquoted, string(ch))
+		}
+	}
+
+	var value strings.Builder
+	for _, p := range tok.Parts {
+		value.WriteString(p.Text)
+	}
+	tok.Value = value.String()
+	return tok, nil
+}
+
+func (s *scanner) scanDoubleQuoted(start Position, add func(Quote, string)) error {
+	// an empty "" still has to produce a (quoted) part
+	add(DoubleQuoted, "")
+
+	for {
+		ch, ok := s.next()
+		if !ok {
+			return unterminated('"', start)
+		}
+
+		switch ch {
+		case '"':
+			return nil
+		case '\\':
+			next, ok := s.next()
+			if !ok {
+				return unterminated('"', start)
+			}
+			switch next {
+			case '"', '\\', '$', '`', ' ':
+				add(Escaped, string(next))
+			case '\n':
 			default:
-				token += string(ch)
+				add(DoubleQuoted, "\\"+string(next))
+			}
+		case '$':
+			raw, err := s.scanDollar(start)
+			if err != nil {
+				return err
+			}
+			add(DoubleQuoted, raw)
+		case '`':
+			raw, err := s.scanBackquote(start)
+			if err != nil {
+				return err
 			}
+			add(DoubleQuoted, raw)
+		default:
+			add(DoubleQuoted, string(ch))
+		}
+	}
+}
+
+// scanDollar is called after a $ has been consumed. ${...} and $(...) are
+// kept together, even across blanks, so the expander can see them whole.
+func (s *scanner) scanDollar(start Position) (string, error) {
+	ch, ok := s.peek()
+	if !ok || (ch != '{' && ch != '(') {
+		return "$", nil
+	}
+
+	from := s.off
+	end := closingIndex(s.src, from)
+	if end < 0 {
+		return "", unterminated(closerOf(ch), start)
+	}
+	for s.off <= end {
+		s.next()
+	}
+	return "$" + s.src[from:end+1], nil
+}
+
+// scanBackquote is called after an opening ` has been consumed.
+func (s *scanner) scanBackquote(start Position) (string, error) {
+	from := s.off
+	end := backquoteEnd(s.src, from)
+	if end < 0 {
+		return "", unterminated('`', start)
+	}
+	for s.off <= end {
+		s.next()
+	}
+	return "`" + s.src[from:end+1], nil
+}
+
+func (s *scanner) scanUntil(end rune) (string, bool) {
+	var text strings.Builder
+	for {
+		ch, ok := s.next()
+		if !ok {
+			return text.String(), false
+		}
+		if ch == end {
+			return text.String(), true
+		}
+		text.WriteRune(ch)
+	}
+}
+
+func (s *scanner) skipBlanks() {
+	for {
+		ch, ok := s.peek()
+		if !ok || !isBlank(ch) {
+			return
+		}
+		s.next()
+	}
+}
+
+func (s *scanner) pos() Position {
+	return Position{Offset: s.off, Line: s.line, Column: s.col}
+}
+
+func (s *scanner) peek() (rune, bool) {
+	if s.off >= len(s.src) {
+		return 0, false
+	}
+	ch, _ := utf8.DecodeRuneInString(s.src[s.off:])
+	return ch, true
+}
+
+func (s *scanner) next() (rune, bool) {
+	if s.off >= len(s.src) {
+		return 0, false
+	}
+	ch, size := utf8.DecodeRuneInString(s.src[s.off:])
+	s.off += size
+	if ch == '\n' {
+		s.line++
+		s.col = 1
+	} else {
+		s.col++
+	}
+	return ch, true
+}
+
+// closingIndex returns the index of the } or ) that closes the bracket at
+// src[open], skipping over quoted text, or -1 if there is none.
+func closingIndex(src string, open int) int {
+	openCh := src[open]
+	closeCh := byte(closerOf(rune(openCh)))
 
-		case escape:
-			if prevState == doubleQuote {
-				switch ch {
-				case '"', '\\', ' ':
-					token += string(ch)
-				default:
-					token += "\\" + string(ch)
+	depth := 0
+	for i := open; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '\'':
+			end := strings.IndexByte(src[i+1:], '\'')
+			if end < 0 {
+				return -1
+			}
+			i += end + 1
+		case '"':
+			for i++; i < len(src) && src[i] != '"'; i++ {
+				if src[i] == '\\' {
+					i++
 				}
-			} else {
-				token += string(ch)
 			}
-			state = prevState
+		case '`':
+			end := backquoteEnd(src, i+1)
+			if end < 0 {
+				return -1
+			}
+			i = end
+		case openCh:
+			depth++
+		case closeCh:
+			depth--
+			if depth == 0 {
+				return i
+			}
 		}
 	}
+	return -1
+}
 
-	if token != "" {
-		tokens = append(tokens, token)
+// backquoteEnd returns the index of the unescaped ` at or after from.
+func backquoteEnd(src string, from int) int {
+	for i := from; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '`':
+			return i
+		}
 	}
+	return -1
+}
 
-	return tokens
+func closerOf(open rune) rune {
+	if open == '(' {
+		return ')'
+	}
+	return '}'
+}
+
+// IncompleteError means the input ended in the middle of a construct. An
+// interactive shell can read more lines and try again.
+type IncompleteError struct {
+	Pos  Position
+	What string
+}
+
+func (e *IncompleteError) Error() string {
+	return fmt.Sprintf("%s: unexpected EOF while looking for %s", e.Pos, e.What)
+}
+
+func unterminated(quote rune, pos Position) error {
+	return &IncompleteError{Pos: pos, What: fmt.Sprintf("matching `%c'", quote)}
+}
+
+func isWordEnd(ch rune) bool {
+	return isBlank(ch) || ch == '\n' || isOperatorStart(ch)
+}
+
+func isBlank(ch rune) bool {
+	return ch == ' ' || ch == '\t'
+}
+
+func isOperatorStart(ch rune) bool {
+	return ch == '|' || ch == '>' || ch == '<' || ch == '&' || ch == ';' || ch == '(' || ch == ')'
+}
+
+func isIONumber(tok Token) bool {
+	if len(tok.Parts) != 1 || tok.Parts[0].Quote != Unquoted {
+		return false
+	}
+	for _, ch := range tok.Value {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,104 @@
+package lexer
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// describe writes tokens as words, <operators> and \n, with quoted parts
+// in the quotes they were written with.
+func describe(tokens []Token) string {
+	var out []string
+	for _, tok := range tokens {
+		switch tok.Kind {
+		case Word:
+			var b strings.Builder
+			for _, part := range tok.Parts {
+				switch part.Quote {
+				case SingleQuoted:
+					b.WriteString("'" + part.Text + "'")
+				case DoubleQuoted:
+					b.WriteString(`"` + part.Text + `"`)
+				case Escaped:
+					b.WriteString(`\` + part.Text)
+				default:
+					b.WriteString(part.Text)
+				}
+			}
+			out = append(out, b.String())
+		case Operator:
+			out = append(out, "<"+tok.Value+">")
+		case Arithmetic:
+			out = append(out, "(("+tok.Value+"))")
+		case Newline:
+			out = append(out, `\n`)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"echo hello   world", "echo hello world"},
+		{"a|b||c&&d&e;f", "a <|> b <||> c <&&> d <&> e <;> f"},
+		{"echo 'a b'\"c d\"\\e", `echo 'a b'"c d"\e`},
+		{`echo "a\"b\$c\d"`, `echo "a"\""b"\$"c\d"`},
+		{"cat <in >out 2>>err 2>&1", "cat <<> in <>> out <2>>> err <2>&> 1"},
+		{"echo $(echo a; echo b) `x y`", "echo $(echo a; echo b) `x y`"},
+		{"echo ${a:-x y}", "echo ${a:-x y}"},
+		{"((x = 1 + 2))", "((x = 1 + 2))"},
+		{"echo ((a))", "echo <(> <(> a <)> <)>"},
+		{"for ((i = 0; i < 2; i++))", "for ((i = 0; i < 2; i++))"},
+		{"if true\nthen :; fi", `if true \n then : <;> fi`},
+		{"f() { :; }", "f <(> <)> { : <;> }"},
+		{"case x in a) :;; esac", "case x in a <)> : <;;> esac"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			tokens, err := Tokenize(tt.line)
+			if err != nil {
+				t.Fatalf("Tokenize(%q): %v", tt.line, err)
+			}
+			if got := describe(tokens); got != tt.want {
+				t.Errorf("Tokenize(%q) = %s, want %s", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeIncomplete(t *testing.T) {
+	for _, line := range []string{
+		"echo 'a",
+		`echo "a`,
+		"echo $(a",
+		"cat <<EOF\nbody",
+	} {
+		_, err := Tokenize(line)
+		var incomplete *IncompleteError
+		if !errors.As(err, &incomplete) {
+			t.Errorf("Tokenize(%q) error = %v, want an IncompleteError", line, err)
+		}
+	}
+}
+
+func TestTokenizeHeredoc(t *testing.T) {
+	tokens, err := Tokenize("cat <<EOF; echo after\nline $x\nEOF\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(tokens, func(tok Token) bool { return tok.IsOperator("<<") })
+	if i < 0 || tokens[i].Body == nil {
+		t.Fatalf("no here-document in %s", describe(tokens))
+	}
+	if got := tokens[i].Body.Value; got != "line $x\n" {
+		t.Errorf("body = %q, want %q", got, "line $x\n")
+	}
+	if got, want := describe(tokens), `cat <<<> EOF <;> echo after \n`; got != want {
+		t.Errorf("tokens = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,397 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/lexer"
+)
+
+// CompoundCommand is a command built from lists, such as if. Redirections
+// written after its closing word apply to all of it.
+type CompoundCommand struct {
+	Body   Node
+	Redirs []Redirect
+}
+
+func (*CompoundCommand) command() {}
+
+// Node is the body of a compound command: an *IfClause, *WhileLoop,
+// *ForLoop, *ArithForLoop, *CaseClause, *Subshell or *BraceGroup.
+type Node interface {
+	node()
+}
+
+// IfClause is if/elif/else/fi. The first branch whose Cond succeeds runs;
+// Else runs when none does and may be nil.
+type IfClause struct {
+	Branches []IfBranch
+	Else     *List
+}
+
+type IfBranch struct {
+	Cond *List
+	Body *List
+}
+
+func (*IfClause) node() {}
+
+// WhileLoop is while, or until when Until is set: Body runs again for as long
+// as Cond succeeds (fails, for until).
+type WhileLoop struct {
+	Cond  *List
+	Body  *List
+	Until bool
+}
+
+func (*WhileLoop) node() {}
+
+// ForLoop is for name in words. Without the in part it runs over the
+// positional parameters.
+type ForLoop struct {
+	Name  string
+	In    bool
+	Words []lexer.Token
+	Body  *List
+}
+
+func (*ForLoop) node() {}
+
+// ArithForLoop is for ((init; cond; step)). An empty Cond counts as true.
+type ArithForLoop struct {
+	Init, Cond, Step string
+	Body             *List
+}
+
+func (*ArithForLoop) node() {}
+
+// CaseClause is case word in ... esac. The items are tried in order.
+type CaseClause struct {
+	Word  lexer.Token
+	Items []CaseItem
+}
+
+// CaseItem is one pattern list and its commands. Terminator is ;; to stop
+// there, ;& to run the next item's commands as well, or ;;& to go on testing
+// the patterns that follow.
+type CaseItem struct {
+	Patterns   []lexer.Token
+	Body       *List
+	Terminator string
+}
+
+func (*CaseClause) node() {}
+
+// Subshell is ( list ): the list runs in a copy of the shell.
+type Subshell struct {
+	Body *List
+}
+
+func (*Subshell) node() {}
+
+// BraceGroup is { list; }: the list runs in the current shell, as a unit
+// that can be redirected or piped.
+type BraceGroup struct {
+	Body *List
+}
+
+func (*BraceGroup) node() {}
+
+/* =========================
+     COMPOUND COMMANDS
+========================= */
+
+// atCompound reports whether a compound command starts at the next token.
+func (p *parser) atCompound() bool {
+	return p.atReserved("if", "while", "until", "for", "case", "{") || p.peek().IsOperator("(")
+}
+
+// isClosingWord reports whether tok is a reserved word that may only end a
+// compound command, so it can never start a simple one.
+func isClosingWord(tok lexer.Token) bool {
+	for _, w := range []string{"then", "elif", "else", "fi", "do", "done", "esac", "}"} {
+		if tok.IsReserved(w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseCompound() (*CompoundCommand, error) {
+	var body Node
+	var err error
+	switch {
+	case p.atReserved("if"):
+		body, err = p.parseIf()
+	case p.atReserved("while", "until"):
+		body, err = p.parseWhile()
+	case p.atReserved("case"):
+		body, err = p.parseCase()
+	case p.atReserved("{"):
+		var list *List
+		list, err = p.parseBraceGroup()
+		body = &BraceGroup{Body: list}
+	case p.peek().IsOperator("("):
+		body, err = p.parseSubshell()
+	default:
+		body, err = p.parseFor()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	redirs, err := p.parseTrailingRedirects()
+	if err != nil {
+		return nil, err
+	}
+	return &CompoundCommand{Body: body, Redirs: redirs}, nil
+}
+
+// parseTrailingRedirects parses the redirections after the closing word of
+// a compound command or function body; anything else there is an error.
+func (p *parser) parseTrailingRedirects() ([]Redirect, error) {
+	start := p.pos
+	for !isCommandEnd(p.peek()) {
+		p.next()
+	}
+	words, redirs, err := ParseRedirect(p.tokens[start:p.pos])
+	if syntax, ok := err.(*SyntaxError); ok && syntax.Token.Kind == lexer.EOF {
+		syntax.Token = p.peek()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(words) > 0 {
+		return nil, &SyntaxError{Token: words[0]}
+	}
+	return redirs, nil
+}
+
+func (p *parser) parseIf() (*IfClause, error) {
+	clause := &IfClause{}
+	p.next() // if
+	for {
+		cond, err := p.parseNonEmptyList("then")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectReserved("then"); err != nil {
+			return nil, err
+		}
+		body, err := p.parseNonEmptyList("elif", "else", "fi")
+		if err != nil {
+			return nil, err
+		}
+		clause.Branches = append(clause.Branches, IfBranch{Cond: cond, Body: body})
+
+		switch {
+		case p.atReserved("elif"):
+			p.next()
+		case p.atReserved("else"):
+			p.next()
+			if clause.Else, err = p.parseNonEmptyList("fi"); err != nil {
+				return nil, err
+			}
+			return clause, p.expectReserved("fi")
+		default:
+			return clause, p.expectReserved("fi")
+		}
+	}
+}
+
+func (p *parser) parseSubshell() (*Subshell, error) {
+	p.next() // (
+	body, err := p.parseNonEmptyList()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.next(); !tok.IsOperator(")") {
+		return nil, &SyntaxError{Token: tok}
+	}
+	return &Subshell{Body: body}, nil
+}
+
+// parseBraceGroup parses { list; }, a brace group or a function body.
+func (p *parser) parseBraceGroup() (*List, error) {
+	if err := p.expectReserved("{"); err != nil {
+		return nil, err
+	}
+	body, err := p.parseNonEmptyList("}")
+	if err != nil {
+		return nil, err
+	}
+	return body, p.expectReserved("}")
+}
+
+func (p *parser) parseWhile() (*WhileLoop, error) {
+	loop := &WhileLoop{Until: p.next().IsReserved("until")}
+	cond, err := p.parseNonEmptyList("do")
+	if err != nil {
+		return nil, err
+	}
+	loop.Cond = cond
+	if loop.Body, err = p.parseDoGroup(); err != nil {
+		return nil, err
+	}
+	return loop, nil
+}
+
+func (p *parser) parseFor() (Node, error) {
+	p.next() // for
+	if tok := p.peek(); tok.Kind == lexer.Arithmetic {
+		return p.parseArithFor()
+	}
+
+	name := p.next()
+	if name.Kind != lexer.Word || name.Quoted() || !lexer.IsName(name.Value) {
+		return nil, &SyntaxError{Token: name}
+	}
+	loop := &ForLoop{Name: name.Value}
+
+	p.skipNewlines()
+	if p.atReserved("in") {
+		p.next()
+		loop.In = true
+		for p.peek().Kind == lexer.Word {
+			loop.Words = append(loop.Words, p.next())
+		}
+		if err := p.endForHeader(); err != nil {
+			return nil, err
+		}
+	} else if p.peek().IsOperator(";") {
+		p.next()
+	}
+
+	body, err := p.parseDoGroup()
+	if err != nil {
+		return nil, err
+	}
+	loop.Body = body
+	return loop, nil
+}
+
+func (p *parser) parseArithFor() (*ArithForLoop, error) {
+	tok := p.next()
+	exprs := strings.Split(tok.Value, ";")
+	if len(exprs) != 3 {
+		return nil, &SyntaxError{Token: tok}
+	}
+	loop := &ArithForLoop{Init: exprs[0], Cond: exprs[1], Step: exprs[2]}
+
+	if p.peek().IsOperator(";") {
+		p.next()
+	}
+	body, err := p.parseDoGroup()
+	if err != nil {
+		return nil, err
+	}
+	loop.Body = body
+	return loop, nil
+}
+
+// endForHeader consumes the ; or newline that ends the word list of a for.
+func (p *parser) endForHeader() error {
+	tok := p.peek()
+	if !tok.IsOperator(";") && tok.Kind != lexer.Newline {
+		return &SyntaxError{Token: tok}
+	}
+	p.next()
+	return nil
+}
+
+// parseDoGroup parses do list done, the body of every loop.
+func (p *parser) parseDoGroup() (*List, error) {
+	p.skipNewlines()
+	if err := p.expectReserved("do"); err != nil {
+		return nil, err
+	}
+	body, err := p.parseNonEmptyList("done")
+	if err != nil {
+		return nil, err
+	}
+	return body, p.expectReserved("done")
+}
+
+func (p *parser) parseCase() (*CaseClause, error) {
+	p.next() // case
+	word := p.next()
+	if word.Kind != lexer.Word {
+		return nil, &SyntaxError{Token: word}
+	}
+	clause := &CaseClause{Word: word}
+
+	p.skipNewlines()
+	if err := p.expectReserved("in"); err != nil {
+		return nil, err
+	}
+
+	for {
+		p.skipNewlines()
+		if p.atReserved("esac") {
+			p.next()
+			return clause, nil
+		}
+
+		item, err := p.parseCaseItem()
+		if err != nil {
+			return nil, err
+		}
+		clause.Items = append(clause.Items, item)
+	}
+}
+
+// parseCaseItem parses [(] pattern [| pattern]... ) list, with the
+// terminator that follows, which may be left out before esac.
+func (p *parser) parseCaseItem() (CaseItem, error) {
+	var item CaseItem
+	if p.peek().IsOperator("(") {
+		p.next()
+	}
+	for {
+		tok := p.next()
+		if tok.Kind != lexer.Word {
+			return CaseItem{}, &SyntaxError{Token: tok}
+		}
+		item.Patterns = append(item.Patterns, tok)
+		if !p.peek().IsOperator("|") {
+			break
+		}
+		p.next()
+	}
+	if tok := p.next(); !tok.IsOperator(")") {
+		return CaseItem{}, &SyntaxError{Token: tok}
+	}
+
+	body, err := p.parseList("esac")
+	if err != nil {
+		return CaseItem{}, err
+	}
+	item.Body = body
+
+	switch tok := p.peek(); {
+	case isCaseTerminator(tok):
+		p.next()
+		item.Terminator = tok.Value
+	case p.atReserved("esac"):
+		item.Terminator = ";;"
+	default:
+		return CaseItem{}, &SyntaxError{Token: tok}
+	}
+	return item, nil
+}
+
+func isCaseTerminator(tok lexer.Token) bool {
+	return tok.IsOperator(";;") || tok.IsOperator(";&") || tok.IsOperator(";;&")
+}
+
+// parseNonEmptyList is parseList for the parts of a compound command, which
+// must hold at least one command.
+func (p *parser) parseNonEmptyList(stops ...string) (*List, error) {
+	list, err := p.parseList(stops...)
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, &SyntaxError{Token: p.peek()}
+	}
+	return list, nil
+}
@@ -0,0 +1,306 @@
+package parser
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/lexer"
+)
+
+/* =========================
+        FORMATTING
+========================= */
+
+// String renders the definition back as shell source, one command per line,
+// the way type shows a function.
+func (f *FunctionDef) String() string {
+	p := &printer{}
+	p.functionDef(f)
+	p.flushHeredocs()
+	return p.b.String()
+}
+
+// String renders the list on one line, compound commands included, as jobs
+// shows it.
+func (a *AndOr) String() string {
+	p := &printer{oneLine: true}
+	p.andOr(a)
+	return p.b.String()
+}
+
+// String renders the pipeline on one line, like (*AndOr).String.
+func (pl *Pipeline) String() string {
+	p := &printer{oneLine: true}
+	p.pipeline(pl)
+	return p.b.String()
+}
+
+// printer writes an AST back out as shell source.
+type printer struct {
+	b      strings.Builder
+	indent int
+	// oneLine puts the bodies of compound commands on the same line,
+	// separated by ;
+	oneLine bool
+	// heredocs are bodies waiting for the end of the current line
+	heredocs []string
+}
+
+func (p *printer) newline() {
+	if p.oneLine {
+		p.b.WriteByte(' ')
+		return
+	}
+	p.b.WriteByte('\n')
+	p.flushHeredocs()
+	p.b.WriteString(strings.Repeat("    ", p.indent))
+}
+
+func (p *printer) flushHeredocs() {
+	if len(p.heredocs) > 0 && !strings.HasSuffix(p.b.String(), "\n") {
+		p.b.WriteByte('\n')
+	}
+	for _, body := range p.heredocs {
+		p.b.WriteString(body)
+		p.b.WriteString("EOF\n")
+	}
+	p.heredocs = nil
+}
+
+// block writes list indented on lines of its own, or in one-line mode
+// after a space and ending in ;.
+func (p *printer) block(list *List) {
+	if p.oneLine {
+		p.b.WriteByte(' ')
+		p.inline(list)
+		if !list.Items[len(list.Items)-1].Background {
+			p.b.WriteByte(';')
+		}
+		p.b.WriteByte(' ')
+		return
+	}
+	p.indent++
+	for _, andOr := range list.Items {
+		p.newline()
+		p.andOr(andOr)
+	}
+	p.indent--
+	p.newline()
+}
+
+// inline writes list on the current line, as for the condition of an if.
+func (p *printer) inline(list *List) {
+	for i, andOr := range list.Items {
+		if i > 0 && !list.Items[i-1].Background {
+			p.b.WriteString(";")
+		}
+		if i > 0 {
+			p.b.WriteString(" ")
+		}
+		p.andOr(andOr)
+	}
+}
+
+func (p *printer) andOr(andOr *AndOr) {
+	for i, pipeline := range andOr.Pipelines {
+		if i > 0 {
+			p.b.WriteString(" " + andOr.Ops[i-1] + " ")
+		}
+		p.pipeline(pipeline)
+	}
+	if andOr.Background {
+		p.b.WriteString(" &")
+	}
+}
+
+func (p *printer) pipeline(pipeline *Pipeline) {
+	for i, cmd := range pipeline.Commands {
+		if i > 0 {
+			p.b.WriteString(" | ")
+		}
+		p.command(cmd)
+	}
+}
+
+func (p *printer) command(cmd Command) {
+	switch cmd := cmd.(type) {
+	case *CommandLine:
+		if cmd.Arith != nil {
+			p.b.WriteString("((" + cmd.Arith.Value + "))")
+		}
+		words := slices.Concat(cmd.Assigns, cmd.Words)
+		for i, word := range words {
+			if i > 0 {
+				p.b.WriteByte(' ')
+			}
+			p.word(word)
+		}
+		p.redirects(cmd.Redirs)
+	case *CompoundCommand:
+		p.compound(cmd.Body)
+		p.redirects(cmd.Redirs)
+	case *FunctionDef:
+		p.functionDef(cmd)
+	}
+}
+
+func (p *printer) functionDef(f *FunctionDef) {
+	p.b.WriteString(f.Name + " ()")
+	p.newline()
+	p.b.WriteString("{")
+	p.block(f.Body)
+	p.b.WriteString("}")
+	p.redirects(f.Redirs)
+}
+
+func (p *printer) compound(body Node) {
+	switch body := body.(type) {
+	case *IfClause:
+		for i, branch := range body.Branches {
+			if i == 0 {
+				p.b.WriteString("if ")
+			} else {
+				p.b.WriteString("elif ")
+			}
+			p.inline(branch.Cond)
+			p.b.WriteString("; then")
+			p.block(branch.Body)
+		}
+		if body.Else != nil {
+			p.b.WriteString("else")
+			p.block(body.Else)
+		}
+		p.b.WriteString("fi")
+
+	case *WhileLoop:
+		if body.Until {
+			p.b.WriteString("until ")
+		} else {
+			p.b.WriteString("while ")
+		}
+		p.inline(body.Cond)
+		p.doGroup(body.Body)
+
+	case *ForLoop:
+		p.b.WriteString("for " + body.Name)
+		if body.In {
+			p.b.WriteString(" in")
+			for _, word := range body.Words {
+				p.b.WriteByte(' ')
+				p.word(word)
+			}
+		}
+		p.doGroup(body.Body)
+
+	case *ArithForLoop:
+		p.b.WriteString("for ((" + body.Init + ";" + body.Cond + ";" + body.Step + "))")
+		p.doGroup(body.Body)
+
+	case *CaseClause:
+		p.b.WriteString("case ")
+		p.word(body.Word)
+		p.b.WriteString(" in")
+		p.indent++
+		for _, item := range body.Items {
+			p.newline()
+			for i, pattern := range item.Patterns {
+				if i > 0 {
+					p.b.WriteString(" | ")
+				}
+				p.word(pattern)
+			}
+			p.b.WriteString(")")
+			if p.oneLine {
+				// the terminator ends the item already
+				p.b.WriteString(" ")
+				p.inline(item.Body)
+				p.b.WriteString(" ")
+			} else {
+				p.block(item.Body)
+			}
+			p.b.WriteString(item.Terminator)
+		}
+		p.indent--
+		p.newline()
+		p.b.WriteString("esac")
+
+	case *Subshell:
+		p.b.WriteString("(")
+		if p.oneLine {
+			p.b.WriteString(" ")
+			p.inline(body.Body)
+			p.b.WriteString(" ")
+		} else {
+			p.block(body.Body)
+		}
+		p.b.WriteString(")")
+
+	case *BraceGroup:
+		p.b.WriteString("{")
+		p.block(body.Body)
+		p.b.WriteString("}")
+	}
+}
+
+func (p *printer) doGroup(body *List) {
+	p.b.WriteString("; do")
+	p.block(body)
+	p.b.WriteString("done")
+}
+
+func (p *printer) redirects(redirs []Redirect) {
+	for _, r := range redirs {
+		p.b.WriteByte(' ')
+		if r.FD != defaultFD(r.Op) {
+			p.b.WriteString(strconv.Itoa(r.FD))
+		}
+		p.b.WriteString(r.Op)
+
+		if r.Op == "<<" || r.Op == "<<-" {
+			// the body was read already, so its own delimiter is gone
+			if r.Target.Quoted() && r.Target.Parts[0].Quote == lexer.SingleQuoted {
+				p.b.WriteString("'EOF'")
+			} else {
+				p.b.WriteString("EOF")
+			}
+			p.heredocs = append(p.heredocs, heredocSource(r.Target))
+			continue
+		}
+		p.word(r.Target)
+	}
+}
+
+func defaultFD(op string) int {
+	if strings.HasPrefix(op, "<") {
+		return 0
+	}
+	return 1
+}
+
+// word writes a word with the quoting it was written with.
+func (p *printer) word(tok lexer.Token) {
+	for _, part := range tok.Parts {
+		switch part.Quote {
+		case lexer.SingleQuoted:
+			p.b.WriteString("'" + part.Text + "'")
+		case lexer.DoubleQuoted:
+			p.b.WriteString(`"` + part.Text + `"`)
+		case lexer.Escaped:
+			p.b.WriteString(`\` + part.Text)
+		default:
+			p.b.WriteString(part.Text)
+		}
+	}
+}
+
+func heredocSource(body lexer.Token) string {
+	var b strings.Builder
+	for _, part := range body.Parts {
+		if part.Quote == lexer.Escaped {
+			b.WriteByte('\\')
+		}
+		b.WriteString(part.Text)
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/lexer"
+)
+
+// FunctionDef is name() { list; }, or function name { list; }. Running it
+// only defines the function; Redirs apply each time the function is called.
+type FunctionDef struct {
+	Name   string
+	Body   *List
+	Redirs []Redirect
+}
+
+func (*FunctionDef) command() {}
+
+/* =========================
+        FUNCTIONS
+========================= */
+
+// atFunctionDef reports whether a function definition starts at the next
+// token: the function keyword, or a name followed by ().
+func (p *parser) atFunctionDef() bool {
+	if p.atReserved("function") {
+		return true
+	}
+	return isFunctionName(p.peek()) &&
+		p.peekAt(p.pos+1).IsOperator("(") &&
+		p.peekAt(p.pos+2).IsOperator(")")
+}
+
+func (p *parser) parseFunctionDef() (*FunctionDef, error) {
+	keyword := p.atReserved("function")
+	if keyword {
+		p.next()
+	}
+
+	name := p.next()
+	if !isFunctionName(name) {
+		return nil, &SyntaxError{Token: name}
+	}
+	// the () is optional after the function keyword
+	if !keyword || p.peek().IsOperator("(") {
+		p.next()
+		if tok := p.next(); !tok.IsOperator(")") {
+			return nil, &SyntaxError{Token: tok}
+		}
+	}
+
+	p.skipNewlines()
+	body, err := p.parseBraceGroup()
+	if err != nil {
+		return nil, err
+	}
+
+	redirs, err := p.parseTrailingRedirects()
+	if err != nil {
+		return nil, err
+	}
+	return &FunctionDef{Name: name.Value, Body: body, Redirs: redirs}, nil
+}
+
+// isFunctionName accepts the unquoted words that can name a function. That
+// is more than variable names: wrapper scripts use names such as git-sync.
+func isFunctionName(tok lexer.Token) bool {
+	return tok.Kind == lexer.Word && tok.Value != "" && !tok.Quoted() &&
+		!strings.ContainsAny(tok.Value, "$`=/") && !isClosingWord(tok)
+}
@@ -0,0 +1,75 @@
+package parser
+
+import "github.com/codecrafters-io/shell-starter-go/internal/lexer"
+
+// List is a sequence of and-or lists separated by ;, & or newlines, run one
+// after the other.
+type List struct {
+	Items []*AndOr
+}
+
+// AndOr is pipelines joined by && and ||. They group left to right with
+// equal precedence: a || b && c runs c when either a or b succeeded.
+type AndOr struct {
+	Pipelines []*Pipeline
+	Ops       []string // Ops[i] joins Pipelines[i] and Pipelines[i+1]
+	// Background is set when the list ends in &, so the shell starts it
+	// as a job and goes on without waiting.
+	Background bool
+}
+
+/* =========================
+       LIST PARSER
+========================= */
+
+// parseList reads and-or lists up to the end of the input or, inside a
+// compound command, up to one of the reserved words that end its part, a )
+// or a case terminator.
+func (p *parser) parseList(stops ...string) (*List, error) {
+	list := &List{}
+	for {
+		p.skipNewlines()
+		if tok := p.peek(); tok.Kind == lexer.EOF || tok.IsOperator(")") || isCaseTerminator(tok) || p.atReserved(stops...) {
+			return list, nil
+		}
+
+		andOr, err := p.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, andOr)
+
+		switch tok := p.peek(); {
+		case tok.IsOperator("&"):
+			andOr.Background = true
+			p.next()
+		case tok.IsOperator(";"), tok.Kind == lexer.Newline:
+			p.next()
+		case tok.Kind == lexer.EOF, tok.IsOperator(")"), isCaseTerminator(tok):
+			return list, nil
+		default:
+			return nil, &SyntaxError{Token: tok}
+		}
+	}
+}
+
+func (p *parser) parseAndOr() (*AndOr, error) {
+	pipeline, err := p.parsePipeline()
+	if err != nil {
+		return nil, err
+	}
+	andOr := &AndOr{Pipelines: []*Pipeline{pipeline}}
+
+	for tok := p.peek(); tok.IsOperator("&&") || tok.IsOperator("||"); tok = p.peek() {
+		p.next()
+		// the next pipeline may start on a later line
+		p.skipNewlines()
+		pipeline, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+		andOr.Ops = append(andOr.Ops, tok.Value)
+		andOr.Pipelines = append(andOr.Pipelines, pipeline)
+	}
+	return andOr, nil
+}
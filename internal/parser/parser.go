@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/lexer"
+)
+
+// SyntaxError points at the token the parser could not accept.
+type SyntaxError struct {
+	Token lexer.Token
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s: syntax error near %s", e.Token.Pos, e.Token)
+}
+
+// IsIncomplete reports whether err only means the input stopped too early,
+// as in a trailing && or an open quote, so that reading more lines may fix it.
+func IsIncomplete(err error) bool {
+	var incomplete *lexer.IncompleteError
+	if errors.As(err, &incomplete) {
+		return true
+	}
+	var syntax *SyntaxError
+	return errors.As(err, &syntax) && syntax.Token.Kind == lexer.EOF
+}
+
+/* =========================
+         PARSER
+========================= */
+
+type parser struct {
+	tokens []lexer.Token
+	pos    int
+}
+
+// Parse turns the tokens of a whole input into its command list.
+func Parse(tokens []lexer.Token) (*List, error) {
+	p := &parser{tokens: tokens}
+	list, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.Kind != lexer.EOF {
+		return nil, &SyntaxError{Token: tok}
+	}
+	return list, nil
+}
+
+func (p *parser) peek() lexer.Token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	if n := len(p.tokens); n > 0 && p.tokens[n-1].Kind == lexer.EOF {
+		return p.tokens[n-1]
+	}
+	return lexer.Token{Kind: lexer.EOF}
+}
+
+// peekAt returns the token at i, or the one at the end of the input.
+func (p *parser) peekAt(i int) lexer.Token {
+	if i < len(p.tokens) {
+		return p.tokens[i]
+	}
+	return p.peek()
+}
+
+func (p *parser) next() lexer.Token {
+	tok := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return tok
+}
+
+// atReserved reports whether the next token is one of the reserved words.
+func (p *parser) atReserved(words ...string) bool {
+	tok := p.peek()
+	for _, w := range words {
+		if tok.IsReserved(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// expectReserved consumes the reserved word w or fails on whatever is there
+// instead.
+func (p *parser) expectReserved(w string) error {
+	if !p.atReserved(w) {
+		return &SyntaxError{Token: p.peek()}
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) skipNewlines() {
+	for p.peek().Kind == lexer.Newline {
+		p.next()
+	}
+}
@@ -0,0 +1,203 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/lexer"
+)
+
+// shape writes the structure of a list: {} around each and-or list, [] around
+// each pipeline, and & after a background one.
+func shape(list *List) string {
+	var items []string
+	for _, andOr := range list.Items {
+		var b strings.Builder
+		b.WriteString("{")
+		for i, pipeline := range andOr.Pipelines {
+			if i > 0 {
+				b.WriteString(" " + andOr.Ops[i-1] + " ")
+			}
+			var cmds []string
+			for _, cmd := range pipeline.Commands {
+				switch cmd := cmd.(type) {
+				case *CommandLine:
+					var words []string
+					for _, word := range cmd.Words {
+						words = append(words, word.Value)
+					}
+					cmds = append(cmds, strings.Join(words, " "))
+				case *CompoundCommand:
+					cmds = append(cmds, compoundShape(cmd.Body))
+				default:
+					cmds = append(cmds, "?")
+				}
+			}
+			b.WriteString("[" + strings.Join(cmds, " | ") + "]")
+		}
+		b.WriteString("}")
+		if andOr.Background {
+			b.WriteString("&")
+		}
+		items = append(items, b.String())
+	}
+	return strings.Join(items, "; ")
+}
+
+func compoundShape(body Node) string {
+	switch body := body.(type) {
+	case *BraceGroup:
+		return "{ " + shape(body.Body) + " }"
+	case *Subshell:
+		return "( " + shape(body.Body) + " )"
+	}
+	return "?"
+}
+
+func TestParsePrecedence(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"a", "{[a]}"},
+		{"a; b", "{[a]}; {[b]}"},
+		{"a | b | c", "{[a | b | c]}"},
+		{"a && b || c", "{[a] && [b] || [c]}"},
+		{"a || b && c", "{[a] || [b] && [c]}"},
+		{"a | b && c | d", "{[a | b] && [c | d]}"},
+		{"a && b; c || d", "{[a] && [b]}; {[c] || [d]}"},
+		{"a && b & c", "{[a] && [b]}&; {[c]}"},
+		{"a | b & c | d &", "{[a | b]}&; {[c | d]}&"},
+		{"a &&\nb ||\n\nc", "{[a] && [b] || [c]}"},
+		{"a |\nb", "{[a | b]}"},
+		{"a\nb;\nc", "{[a]}; {[b]}; {[c]}"},
+		{"a && { b; c; } | d", "{[a] && [{ {[b]}; {[c]} } | d]}"},
+		{"(a || b) && c", "{[( {[a] || [b]} )] && [c]}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			tokens, err := lexer.Tokenize(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			list, err := Parse(tokens)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.line, err)
+			}
+			if got := shape(list); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		line       string
+		incomplete bool
+	}{
+		{"| a", false},
+		{"a ||", true},
+		{"a |", true},
+		{"a && && b", false},
+		{"; a", false},
+		{"a;;", false},
+		{"& a", false},
+		{"{ a;", true},
+		{"(a", true},
+		{"a )", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			tokens, err := lexer.Tokenize(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = Parse(tokens)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded", tt.line)
+			}
+			if got := IsIncomplete(err); got != tt.incomplete {
+				t.Errorf("Parse(%q) error = %v, incomplete %v, want %v", tt.line, err, got, tt.incomplete)
+			}
+		})
+	}
+}
+
+// caseShape writes each item of a case clause as its patterns joined by |,
+// then ) and the shape of its body, then its terminator.
+func caseShape(clause *CaseClause) string {
+	var items []string
+	for _, item := range clause.Items {
+		var patterns []string
+		for _, pattern := range item.Patterns {
+			patterns = append(patterns, pattern.Value)
+		}
+		items = append(items, strings.Join(patterns, "|")+") "+shape(item.Body)+" "+item.Terminator)
+	}
+	return strings.Join(items, " ")
+}
+
+func TestParseCase(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"case x in a) b;; esac", "a) {[b]} ;;"},
+		{"case x in (a|b) c\nesac", "a|b) {[c]} ;;"},
+		{"case x in a) b;& c) d;;& *) e; f;; esac", "a) {[b]} ;& c) {[d]} ;;& *) {[e]}; {[f]} ;;"},
+		{"case x in\na)\nb\n;;\nesac", "a) {[b]} ;;"},
+		{"case x in a) ;; esac", "a)  ;;"},
+		{"case x in esac", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			tokens, err := lexer.Tokenize(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			list, err := Parse(tokens)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.line, err)
+			}
+			cmd, ok := list.Items[0].Pipelines[0].Commands[0].(*CompoundCommand)
+			if !ok {
+				t.Fatalf("Parse(%q) is not a compound command", tt.line)
+			}
+			clause, ok := cmd.Body.(*CaseClause)
+			if !ok {
+				t.Fatalf("Parse(%q) is not a case clause", tt.line)
+			}
+			if got := caseShape(clause); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCaseErrors(t *testing.T) {
+	tests := []struct {
+		line       string
+		incomplete bool
+	}{
+		{"case x in a) b;;", true},
+		{"case x in a b) c;; esac", false},
+		{"case x a) b;; esac", false},
+		{"case x in a) b; esac c", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			tokens, err := lexer.Tokenize(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = Parse(tokens)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded", tt.line)
+			}
+			if got := IsIncomplete(err); got != tt.incomplete {
+				t.Errorf("Parse(%q) error = %v, incomplete %v, want %v", tt.line, err, got, tt.incomplete)
+			}
+		})
+	}
+}
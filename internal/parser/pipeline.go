@@ -1,53 +1,123 @@
 package parser
 
-import "fmt"
+import "github.com/codecrafters-io/shell-starter-go/internal/lexer"
 
-type CommandLine struct {
-	Name  string
-	Args  []string
-	Redir Redirect
+// Pipeline is commands joined by |.
+type Pipeline struct {
+	Commands []Command
 }
 
-func ParsePipeline(tokens []string) ([]CommandLine, error) {
-	if len(tokens) == 0 {
-		return nil, nil
-	}
+// Command is one stage of a pipeline: a *CommandLine, a *CompoundCommand or
+// a *FunctionDef.
+type Command interface {
+	command()
+}
 
-	segments := make([][]string, 0, 1)
-	current := make([]string, 0)
+// CommandLine keeps its words unexpanded; expansion happens when the command
+// runs, so it sees the variables as they are at that point.
+type CommandLine struct {
+	// Assigns are the NAME=value words in front of the command name. With
+	// no Words they set shell variables, otherwise only the command's
+	// environment.
+	Assigns []lexer.Token
+	Words   []lexer.Token
+	Redirs  []Redirect
+	// Arith is set instead of Words for a (( expr )) command.
+	Arith *lexer.Token
+}
 
-	for _, tok := range tokens {
-		if tok == "|" {
-			if len(current) == 0 {
-				return nil, fmt.Errorf("syntax error near |")
-			}
-			segments = append(segments, current)
-			current = make([]string, 0)
-			continue
-		}
-		current = append(current, tok)
-	}
+func (*CommandLine) command() {}
 
-	if len(current) == 0 {
-		return nil, fmt.Errorf("syntax error near |")
+func (p *parser) parsePipeline() (*Pipeline, error) {
+	cmd, err := p.parseCommand()
+	if err != nil {
+		return nil, err
 	}
-	segments = append(segments, current)
+	pipeline := &Pipeline{Commands: []Command{cmd}}
 
-	commands := make([]CommandLine, 0, len(segments))
-	for _, segment := range segments {
-		name, args, redir, err := ParseRedirect(segment)
+	for p.peek().IsOperator("|") {
+		p.next()
+		p.skipNewlines()
+		cmd, err := p.parseCommand()
 		if err != nil {
 			return nil, err
 		}
-		if name == "" {
-			return nil, fmt.Errorf("syntax error near |")
-		}
-		commands = append(commands, CommandLine{
-			Name:  name,
-			Args:  args,
-			Redir: redir,
-		})
+		pipeline.Commands = append(pipeline.Commands, cmd)
+	}
+	return pipeline, nil
+}
+
+func (p *parser) parseCommand() (Command, error) {
+	if p.atCompound() {
+		return p.parseCompound()
+	}
+	if p.atFunctionDef() {
+		return p.parseFunctionDef()
+	}
+
+	start := p.pos
+	for !isCommandEnd(p.peek()) {
+		p.next()
+	}
+	segment := p.tokens[start:p.pos]
+	if len(segment) == 0 || isClosingWord(segment[0]) {
+		return nil, &SyntaxError{Token: p.peekAt(start)}
+	}
+
+	cmd, err := parseSimpleCommand(segment)
+	if syntax, ok := err.(*SyntaxError); ok && syntax.Token.Kind == lexer.EOF {
+		// a redirection missing its target, as in echo > ;
+		syntax.Token = p.peek()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func parseSimpleCommand(segment []lexer.Token) (*CommandLine, error) {
+	if segment[0].Kind == lexer.Arithmetic {
+		return parseArithCommand(segment)
+	}
+
+	words, redirs, err := ParseRedirect(segment)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	for n < len(words) && lexer.IsAssignment(words[n]) {
+		n++
 	}
+	if len(words) == 0 && len(redirs) == 0 {
+		return nil, &SyntaxError{Token: segment[0]}
+	}
+	return &CommandLine{Assigns: words[:n], Words: words[n:], Redirs: redirs}, nil
+}
+
+// parseArithCommand parses a (( expr )) command, which may only be followed
+// by redirects.
+func parseArithCommand(segment []lexer.Token) (*CommandLine, error) {
+	arith := segment[0]
+	words, redirs, err := ParseRedirect(segment[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(words) > 0 {
+		return nil, &SyntaxError{Token: words[0]}
+	}
+	return &CommandLine{Arith: &arith, Redirs: redirs}, nil
+}
 
-	return commands, nil
+// isCommandEnd reports whether tok ends a simple command.
+func isCommandEnd(tok lexer.Token) bool {
+	switch tok.Kind {
+	case lexer.Newline, lexer.EOF:
+		return true
+	case lexer.Operator:
+		switch tok.Value {
+		case "|", ";", "&", "&&", "||", ";;", ";&", ";;&", "(", ")":
+			return true
+		}
+	}
+	return false
 }
@@ -1,64 +1,102 @@
 package parser
 
-import "fmt"
+import (
+	"strconv"
+	"strings"
 
+	"github.com/codecrafters-io/shell-starter-go/internal/lexer"
+)
+
+// Redirect is one redirection, kept unexpanded. Redirections apply in the
+// order they were written.
 type Redirect struct {
-	Stdout       string
-	StdoutAppend bool
-	Stderr       string
-	StderrAppend bool
+	Op string // the operator without its fd number, e.g. ">>" or ">&"
+	FD int    // the descriptor being redirected
+	// Target is the file name, the fd for >& and <&, or the body of a
+	// here-document or here-string.
+	Target lexer.Token
 }
 
 /* =========================
      REDIRECT PARSER
 ========================= */
 
-func ParseRedirect(tokens []string) (cmd string, args []string, redir Redirect, err error) {
-	if len(tokens) == 0 {
-		return "", nil, redir, nil
-	}
-
-	cmd = tokens[0]
-
-	for i := 1; i < len(tokens); i++ {
-		switch tokens[i] {
+func ParseRedirect(tokens []lexer.Token) (words []lexer.Token, redirs []Redirect, err error) {
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.Kind != lexer.Operator {
+			words = append(words, tok)
+			continue
+		}
 
-		case ">", "1>":
-			if i+1 >= len(tokens) {
-				return "", nil, redir, fmt.Errorf("syntax error near >")
-			}
-			redir.Stdout = tokens[i+1]
-			redir.StdoutAppend = false
-			i++
+		if i+1 >= len(tokens) || tokens[i+1].Kind != lexer.Word {
+			return nil, nil, &SyntaxError{Token: nextToken(tokens, i)}
+		}
+		target := tokens[i+1]
+		i++
 
-		case ">>", "1>>":
-			if i+1 >= len(tokens) {
-				return "", nil, redir, fmt.Errorf("syntax error near >>")
-			}
-			redir.Stdout = tokens[i+1]
-			redir.StdoutAppend = true
-			i++
+		redir, ok := newRedirect(tok, target)
+		if !ok {
+			return nil, nil, &SyntaxError{Token: tok}
+		}
+		redirs = append(redirs, redir)
+	}
 
-		case "2>":
-			if i+1 >= len(tokens) {
-				return "", nil, redir, fmt.Errorf("syntax error near 2>")
-			}
-			redir.Stderr = tokens[i+1]
-			redir.StderrAppend = false
-			i++
+	return words, redirs, nil
+}
 
-		case "2>>":
-			if i+1 >= len(tokens) {
-				return "", nil, redir, fmt.Errorf("syntax error near 2>>")
-			}
-			redir.Stderr = tokens[i+1]
-			redir.StderrAppend = true
-			i++
+func newRedirect(tok, target lexer.Token) (Redirect, bool) {
+	op := strings.TrimLeft(tok.Value, "0123456789")
+	fd := -1
+	if n := len(tok.Value) - len(op); n > 0 {
+		parsed, err := strconv.Atoi(tok.Value[:n])
+		if err != nil {
+			return Redirect{}, false
+		}
+		fd = parsed
+	}
 
-		default:
-			args = append(args, tokens[i])
+	switch op {
+	case "<", "<&", "<>", "<<<":
+		if fd < 0 {
+			fd = 0
+		}
+	case "<<", "<<-":
+		if fd < 0 {
+			fd = 0
+		}
+		if tok.Body == nil {
+			return Redirect{}, false
+		}
+		target = *tok.Body
+	case ">", ">>", ">|", ">&":
+		if fd < 0 {
+			fd = 1
+		}
+	case "&>", "&>>":
+		// stdout and stderr together; never takes an fd number
+		if fd >= 0 {
+			return Redirect{}, false
 		}
+		fd = 1
+	default:
+		return Redirect{}, false
 	}
 
-	return cmd, args, redir, nil
+	return Redirect{Op: op, FD: fd, Target: target}, true
+}
+
+func nextToken(tokens []lexer.Token, i int) lexer.Token {
+	if i+1 < len(tokens) {
+		return tokens[i+1]
+	}
+	last := tokens[i]
+	return lexer.Token{
+		Kind: lexer.EOF,
+		Pos: lexer.Position{
+			Offset: last.Pos.Offset + len(last.Value),
+			Line:   last.Pos.Line,
+			Column: last.Pos.Column + len([]rune(last.Value)),
+		},
+	}
 }
@@ -1,78 +1,370 @@
 package runtime
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
-
-	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 )
 
+// Redirect is a parser.Redirect whose target has been expanded. For
+// here-documents and here-strings Target is the text itself.
+type Redirect struct {
+	Op     string
+	FD     int
+	Target string
+	// Dir is the directory a relative file name in Target is opened in.
+	Dir string
+	// NoClobber is set -o noclobber: > and &> must not overwrite an
+	// existing regular file. >| overwrites it regardless.
+	NoClobber bool
+}
+
+// path returns Target as a file name, resolved against Dir.
+func (r Redirect) path() string {
+	if r.Dir == "" || filepath.IsAbs(r.Target) {
+		return r.Target
+	}
+	return filepath.Join(r.Dir, r.Target)
+}
+
+// FD is an open descriptor. File is set when it is backed by a real file, so
+// it can be handed to a child process as is.
+type FD struct {
+	Reader io.Reader
+	Writer io.Writer
+	File   *os.File
+}
+
+func fileFD(f *os.File) *FD {
+	return &FD{Reader: f, Writer: f, File: f}
+}
+
+func ReaderFD(r io.Reader) *FD {
+	if f, ok := r.(*os.File); ok {
+		return fileFD(f)
+	}
+	return &FD{Reader: r}
+}
+
+func WriterFD(w io.Writer) *FD {
+	if f, ok := w.(*os.File); ok {
+		return fileFD(f)
+	}
+	return &FD{Writer: w}
+}
+
 /* =========================
      IO CONTEXT
 ========================= */
 
+// IOContext is a descriptor table: the shell's own, or one command's.
 type IOContext struct {
-	Stdin   io.Reader
-	Stdout  io.Writer
-	Stderr  io.Writer
-	outFile *os.File
-	errFile *os.File
+	fds    map[int]*FD
+	opened []*os.File // files this table opened and must close
 }
 
 func NewIOContext() *IOContext {
 	return &IOContext{
-		Stdin:  os.Stdin,
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
+		fds: map[int]*FD{
+			0: fileFD(os.Stdin),
+			1: fileFD(os.Stdout),
+			2: fileFD(os.Stderr),
+		},
+	}
+}
+
+// Clone copies the table. The copy shares the open files but does not own
+// them, so closing it leaves the original intact.
+func (c *IOContext) Clone() *IOContext {
+	fds := make(map[int]*FD, len(c.fds))
+	for fd, f := range c.fds {
+		fds[fd] = f
+	}
+	return &IOContext{fds: fds}
+}
+
+func (c *IOContext) Set(fd int, f *FD) {
+	if c.fds[fd] == f {
+		// releasing it would close the file being kept, as in 1>&1
+		return
+	}
+	c.release(fd)
+	if f != nil {
+		c.fds[fd] = f
+	}
+}
+
+func (c *IOContext) Get(fd int) *FD {
+	return c.fds[fd]
+}
+
+func (c *IOContext) Stdin() io.Reader {
+	if f := c.fds[0]; f != nil && f.Reader != nil {
+		return f.Reader
+	}
+	return badFD{}
+}
+
+func (c *IOContext) Stdout() io.Writer {
+	return c.writer(1)
+}
+
+func (c *IOContext) Stderr() io.Writer {
+	return c.writer(2)
+}
+
+func (c *IOContext) writer(fd int) io.Writer {
+	if f := c.fds[fd]; f != nil && f.Writer != nil {
+		return f.Writer
 	}
+	return badFD{}
 }
 
-func (io *IOContext) Apply(redir parser.Redirect) error {
-	// stdout
-	if redir.Stdout != "" {
-		flags := os.O_CREATE | os.O_WRONLY
-		if redir.StdoutAppend {
-			flags |= os.O_APPEND
-		} else {
-			flags |= os.O_TRUNC
+// Files returns the descriptors that are backed by real files.
+func (c *IOContext) Files() map[int]*os.File {
+	files := make(map[int]*os.File)
+	for fd, f := range c.fds {
+		if f.File != nil {
+			files[fd] = f.File
 		}
+	}
+	return files
+}
 
-		f, err := os.OpenFile(redir.Stdout, flags, 0644)
-		if err != nil {
-			return err
+// ExtraFiles lays out descriptors 3 and up for exec.Cmd.ExtraFiles. A
+// descriptor that is not a file, such as a here-document, is bridged through
+// a pipe; the pipe is closed along with the table.
+func (c *IOContext) ExtraFiles() []*os.File {
+	highest := 2
+	for fd := range c.fds {
+		highest = max(highest, fd)
+	}
+	if highest < 3 {
+		return nil
+	}
+
+	files := make([]*os.File, highest-2)
+	for fd := 3; fd <= highest; fd++ {
+		f := c.fds[fd]
+		switch {
+		case f == nil:
+		case f.File != nil:
+			files[fd-3] = f.File
+		default:
+			files[fd-3] = c.bridge(f)
 		}
-		io.outFile = f
-		io.Stdout = f
 	}
+	return files
+}
+
+func (c *IOContext) bridge(f *FD) *os.File {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil
+	}
+
+	if f.Reader != nil {
+		c.opened = append(c.opened, r)
+		go func() {
+			io.Copy(w, f.Reader)
+			w.Close()
+		}()
+		return r
+	}
+
+	c.opened = append(c.opened, w)
+	go func() {
+		io.Copy(f.Writer, r)
+		r.Close()
+	}()
+	return w
+}
 
-	// stderr
-	if redir.Stderr != "" {
-		flags := os.O_CREATE | os.O_WRONLY
-		if redir.StderrAppend {
-			flags |= os.O_APPEND
-		} else {
-			flags |= os.O_TRUNC
+// Writes reports whether any descriptor writes to w.
+func (c *IOContext) Writes(w io.Writer) bool {
+	for _, f := range c.fds {
+		if f.Writer == w {
+			return true
 		}
+	}
+	return false
+}
 
-		f, err := os.OpenFile(redir.Stderr, flags, 0644)
-		if err != nil {
-			io.Close()
+// Apply performs the redirections left to right, so that 2>&1 >out and
+// >out 2>&1 differ the way POSIX requires.
+func (c *IOContext) Apply(redirs []Redirect) error {
+	for _, r := range redirs {
+		if err := c.apply(r); err != nil {
 			return err
 		}
-		io.errFile = f
-		io.Stderr = f
 	}
+	return nil
+}
+
+func (c *IOContext) apply(r Redirect) error {
+	if !validFD(r.FD) {
+		return fmt.Errorf("%d: bad file descriptor", r.FD)
+	}
+	switch r.Op {
+	case "<":
+		return c.open(r.FD, r, os.O_RDONLY)
+	case ">", ">|":
+		return c.create(r.FD, r)
+	case ">>":
+		return c.open(r.FD, r, os.O_CREATE|os.O_WRONLY|os.O_APPEND)
+	case "<>":
+		return c.open(r.FD, r, os.O_CREATE|os.O_RDWR)
+	case "&>":
+		return c.openBoth(r, false)
+	case "&>>":
+		return c.openBoth(r, true)
+	case "<<", "<<-", "<<<":
+		c.Set(r.FD, &FD{Reader: strings.NewReader(r.Target)})
+		return nil
+	case ">&", "<&":
+		return c.dup(r)
+	}
+	return fmt.Errorf("%s: unsupported redirection", r.Op)
+}
+
+// validFD reports whether fd is below the limit on open descriptors, so
+// that a child process could be given it.
+func validFD(fd int) bool {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return fd >= 0
+	}
+	return fd >= 0 && uint64(fd) < limit.Cur
+}
+
+func (c *IOContext) dup(r Redirect) error {
+	if r.Target == "-" {
+		c.release(r.FD)
+		return nil
+	}
+
+	src, err := strconv.Atoi(r.Target)
+	if err != nil {
+		// >&file is an old spelling of &>file
+		if r.Op == ">&" && r.FD == 1 {
+			return c.openBoth(r, false)
+		}
+		return fmt.Errorf("%s: ambiguous redirect", r.Target)
+	}
+
+	f := c.fds[src]
+	if f == nil {
+		return fmt.Errorf("%d: bad file descriptor", src)
+	}
+	c.Set(r.FD, f)
+	return nil
+}
 
+func (c *IOContext) open(fd int, r Redirect, flags int) error {
+	f, err := os.OpenFile(r.path(), flags, 0644)
+	if err != nil {
+		// name the file as it was written, and the reason the way
+		// strerror does, as in "out: Permission denied"
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			return fmt.Errorf("%s: %s", r.Target, reason(pathErr.Err))
+		}
+		return err
+	}
+	c.Set(fd, fileFD(f))
+	c.opened = append(c.opened, f)
 	return nil
 }
 
-func (io *IOContext) Close() {
-	if io.errFile != nil {
-		io.errFile.Close()
-		io.errFile = nil
+// reason returns the text of err with a capital letter.
+func reason(err error) string {
+	msg := err.Error()
+	if msg == "" {
+		return msg
 	}
-	if io.outFile != nil {
-		io.outFile.Close()
-		io.outFile = nil
+	return strings.ToUpper(msg[:1]) + msg[1:]
+}
+
+// create opens r's file for writing from the start, truncating it. With
+// noclobber an existing regular file is an error instead, unless the
+// operator is >|; anything else, such as /dev/null, is opened as it is.
+func (c *IOContext) create(fd int, r Redirect) error {
+	if !r.NoClobber || r.Op == ">|" {
+		return c.open(fd, r, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
 	}
+	info, err := os.Stat(r.path())
+	if err == nil && info.Mode().IsRegular() {
+		return fmt.Errorf("%s: cannot overwrite existing file", r.Target)
+	}
+	flags := os.O_WRONLY
+	if err != nil {
+		// a file made meanwhile is not overwritten either
+		flags |= os.O_CREATE | os.O_EXCL
+	}
+	return c.open(fd, r, flags)
+}
+
+// openBoth opens r's file as both stdout and stderr, appending to it for
+// &>> and truncating it otherwise.
+func (c *IOContext) openBoth(r Redirect, appending bool) error {
+	var err error
+	if appending {
+		err = c.open(1, r, os.O_CREATE|os.O_WRONLY|os.O_APPEND)
+	} else {
+		err = c.create(1, r)
+	}
+	if err != nil {
+		return err
+	}
+	c.Set(2, c.fds[1])
+	return nil
+}
+
+// release drops fd from the table, closing its file once nothing else in
+// the table refers to it and the table opened it.
+func (c *IOContext) release(fd int) {
+	f := c.fds[fd]
+	delete(c.fds, fd)
+	if f == nil || f.File == nil {
+		return
+	}
+	for _, other := range c.fds {
+		if other.File == f.File {
+			return
+		}
+	}
+	for i, owned := range c.opened {
+		if owned == f.File {
+			owned.Close()
+			c.opened = append(c.opened[:i], c.opened[i+1:]...)
+			return
+		}
+	}
+}
+
+// Close closes the files opened by redirections.
+func (c *IOContext) Close() {
+	for _, f := range c.opened {
+		f.Close()
+	}
+	c.opened = nil
+}
+
+// badFD stands in for a closed descriptor.
+type badFD struct{}
+
+var errBadFD = errors.New("bad file descriptor")
+
+func (badFD) Read([]byte) (int, error) {
+	return 0, errBadFD
+}
+
+func (badFD) Write([]byte) (int, error) {
+	return 0, errBadFD
 }
@@ -0,0 +1,31 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/command"
+	"github.com/codecrafters-io/shell-starter-go/internal/lexer"
+)
+
+// arithCommand runs a (( expr )) command. It succeeds when expr is non-zero.
+type arithCommand struct {
+	expander *lexer.Expander
+	expr     string
+}
+
+func (c arithCommand) Name() string {
+	return "(("
+}
+
+func (c arithCommand) Execute(ctx context.Context, args []string, io command.IO) command.Result {
+	value, err := c.expander.Arithmetic(c.expr)
+	if err != nil {
+		fmt.Fprintf(io.Stderr, "((: %v\n", err)
+		return command.Error
+	}
+	if value == 0 {
+		return command.Error
+	}
+	return command.Ok
+}
@@ -0,0 +1,117 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/command"
+	"github.com/codecrafters-io/shell-starter-go/internal/lexer"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	shellruntime "github.com/codecrafters-io/shell-starter-go/internal/runtime"
+)
+
+/* =========================
+    COMPOUND COMMANDS
+========================= */
+
+// executeCompound runs the body of a compound command and returns its
+// status. Its commands start from the descriptors in fds.
+func (s *Shell) executeCompound(ctx context.Context, body parser.Node, fds *shellruntime.IOContext) command.Result {
+	switch body := body.(type) {
+	case *parser.IfClause:
+		return s.executeIf(ctx, body, fds)
+	case *parser.WhileLoop:
+		return s.executeWhile(ctx, body, fds)
+	case *parser.ForLoop:
+		return s.executeFor(ctx, body, fds)
+	case *parser.ArithForLoop:
+		return s.executeArithFor(ctx, body, fds)
+	case *parser.CaseClause:
+		return s.executeCase(ctx, body, fds)
+	case *parser.Subshell:
+		return s.executeSubshell(ctx, body, fds)
+	case *parser.BraceGroup:
+		s.executeList(ctx, body.Body, fds)
+		return s.status
+	}
+	return command.Error
+}
+
+// executeIf runs the body of the first branch whose condition succeeds. With
+// no such branch and no else, the status is 0.
+func (s *Shell) executeIf(ctx context.Context, clause *parser.IfClause, fds *shellruntime.IOContext) command.Result {
+	for _, branch := range clause.Branches {
+		s.conditions++
+		s.executeList(ctx, branch.Cond, fds)
+		s.conditions--
+		if s.unwinding() {
+			return s.status
+		}
+		if s.status == command.Ok {
+			s.executeList(ctx, branch.Body, fds)
+			return s.status
+		}
+	}
+
+	if clause.Else != nil {
+		s.executeList(ctx, clause.Else, fds)
+		return s.status
+	}
+	return command.Ok
+}
+
+// executeCase runs the commands of the first item with a pattern matching
+// the word, then carries on as that item's terminator says.
+func (s *Shell) executeCase(ctx context.Context, clause *parser.CaseClause, fds *shellruntime.IOContext) command.Result {
+	expander := s.newExpander(ctx, fds)
+	word, err := expander.ExpandWord(clause.Word)
+	if err != nil {
+		fmt.Fprintln(fds.Stderr(), err)
+		return command.Error
+	}
+
+	status := command.Ok
+	fallThrough := false
+	for _, item := range clause.Items {
+		if !fallThrough {
+			matched, err := matchCase(expander, word, item.Patterns)
+			if err != nil {
+				fmt.Fprintln(fds.Stderr(), err)
+				return command.Error
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		s.status = command.Ok
+		s.executeList(ctx, item.Body, fds)
+		status = s.status
+		if s.unwinding() {
+			return status
+		}
+
+		switch item.Terminator {
+		case ";&":
+			fallThrough = true
+		case ";;&":
+			fallThrough = false
+		default:
+			return status
+		}
+	}
+	return status
+}
+
+func matchCase(expander *lexer.Expander, word string, patterns []lexer.Token) (bool, error) {
+	for _, tok := range patterns {
+		pattern, err := expander.ExpandPattern(tok)
+		if err != nil {
+			return false, err
+		}
+		if lexer.Match(pattern, word) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,144 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/command"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	shellruntime "github.com/codecrafters-io/shell-starter-go/internal/runtime"
+)
+
+/* =========================
+        FUNCTIONS
+========================= */
+
+// frame is a running function call: its positional parameters, and the
+// variables its local variables hide, to put back when it returns. A nil
+// variable means it was unset.
+type frame struct {
+	args  []string
+	saved map[string]*variable
+}
+
+var (
+	errNotInFunction = errors.New("can only be used in a function")
+	errNoReturn      = errors.New("can only `return' from a function")
+)
+
+// callFunction runs fn with args as its positional parameters and returns
+// its status.
+func (s *Shell) callFunction(ctx context.Context, fn *parser.FunctionDef, args []string, fds *shellruntime.IOContext) command.Result {
+	redirs, err := s.expandRedirects(s.newExpander(ctx, fds), fn.Redirs)
+	if err != nil {
+		fmt.Fprintln(fds.Stderr(), err)
+		return command.Error
+	}
+	fds = fds.Clone()
+	defer fds.Close()
+	if err := fds.Apply(redirs); err != nil {
+		fmt.Fprintln(fds.Stderr(), err)
+		return command.Error
+	}
+
+	s.frames = append(s.frames, &frame{args: args, saved: map[string]*variable{}})
+	// break and continue can't reach the caller's loops
+	loops := s.loops
+	s.loops = 0
+	defer func() {
+		s.loops = loops
+		s.popFrame()
+	}()
+	// a RETURN trap the function sets runs as it returns, with its locals
+	// still in place; the caller's own comes back afterwards
+	restoreTrap := s.hideTrap("RETURN")
+	defer func() {
+		if action, ok := s.trapAction("RETURN"); ok {
+			s.runTrap(ctx, action, fds)
+		}
+		restoreTrap()
+	}()
+
+	s.status = command.Ok
+	s.executeList(ctx, fn.Body, fds)
+	if s.flow == flowReturn {
+		s.flow = flowNext
+	}
+	return s.status
+}
+
+func (s *Shell) popFrame() {
+	f := s.frames[len(s.frames)-1]
+	s.frames = s.frames[:len(s.frames)-1]
+	for name, v := range f.saved {
+		if v == nil {
+			delete(s.vars, name)
+		} else {
+			s.vars[name] = v
+		}
+	}
+}
+
+// positional returns $1, $2, ... of the innermost function call. Outside
+// functions there are none.
+func (s *Shell) positional() []string {
+	if len(s.frames) == 0 {
+		return nil
+	}
+	return s.frames[len(s.frames)-1].args
+}
+
+// Local makes name local to the running function: it starts out unset, and
+// its value outside comes back when the function returns.
+func (s *Shell) Local(name string) error {
+	if len(s.frames) == 0 {
+		return errNotInFunction
+	}
+	f := s.frames[len(s.frames)-1]
+	if v, ok := s.vars[name]; ok && v.readonly {
+		return errReadonly(name)
+	}
+	if _, ok := f.saved[name]; !ok {
+		f.saved[name] = s.vars[name]
+	}
+	return s.UnsetVar(name)
+}
+
+// Return backs the return builtin: the running function stops with status.
+func (s *Shell) Return(status command.Result) error {
+	if len(s.frames) == 0 {
+		return errNoReturn
+	}
+	s.flow = flowReturn
+	s.status = status
+	return nil
+}
+
+// FunctionSource returns the definition of the function name, for type.
+func (s *Shell) FunctionSource(name string) (string, bool) {
+	fn, ok := s.functions[name]
+	if !ok {
+		return "", false
+	}
+	return fn.String(), true
+}
+
+// newFunctionRunner runs a function as a pipeline stage.
+func (s *Shell) newFunctionRunner(ctx context.Context, fn *parser.FunctionDef, args []string, setup pipeSetup) runner {
+	done := make(chan command.Result, 1)
+
+	return runner{
+		start: func() error {
+			go func() {
+				status := s.callFunction(ctx, fn, args, setup.ioCtx)
+				s.closePipelineIO(setup)
+				done <- status
+			}()
+			return nil
+		},
+		wait: func() command.Result {
+			return <-done
+		},
+	}
+}
@@ -0,0 +1,671 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/command"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	shellruntime "github.com/codecrafters-io/shell-starter-go/internal/runtime"
+)
+
+/* =========================
+          JOBS
+========================= */
+
+type jobState int
+
+const (
+	jobRunning jobState = iota
+	jobStopped
+	jobDone
+)
+
+// si_code values waitid reports; x/sys/unix does not name them.
+const (
+	cldStopped   = 5
+	cldContinued = 6
+)
+
+// job is a pipeline started with &, or one in the foreground that the
+// terminal can stop. Its external processes share a process group, so that
+// signals from the terminal, fg, bg and kill reach all of them.
+type job struct {
+	text string
+	// foreground is set while the job should own the terminal: a process
+	// that starts a new group for it takes the terminal along.
+	foreground bool
+	tty        int
+
+	mu sync.Mutex
+	id int // its number in the table; 0 until it goes in
+	// pgid is the job's process group, 0 until a process starts. When all
+	// of its processes are gone the next one starts a new group.
+	pgid     int
+	pids     []int
+	stopped  map[int]bool // processes stopped by a signal
+	state    jobState
+	statuses []command.Result
+	// modes are the terminal settings the job had when it stopped, to put
+	// back when it runs in the foreground again.
+	modes *term.State
+	// changed is closed, and replaced, whenever state changes.
+	changed chan struct{}
+	started chan struct{} // closed once a process starts or the job ends
+	startMu sync.Once
+	// reported is the state the user was last told about.
+	reported jobState
+}
+
+func newJob(text string) *job {
+	return &job{
+		text:    text,
+		tty:     -1,
+		stopped: make(map[int]bool),
+		changed: make(chan struct{}),
+		started: make(chan struct{}),
+	}
+}
+
+// start starts cmd as a process of the job, in its process group.
+func (j *job) start(cmd *exec.Cmd) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.pgid != 0 && unix.Kill(-j.pgid, 0) == unix.ESRCH {
+		// everything in the group has been reaped, so the group is gone
+		j.pgid = 0
+	}
+	attr := &syscall.SysProcAttr{Setpgid: true, Pgid: j.pgid}
+	if j.pgid == 0 && j.foreground && j.tty >= 0 {
+		attr.Foreground, attr.Ctty = true, j.tty
+	}
+	cmd.SysProcAttr = attr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pid := cmd.Process.Pid
+	if j.pgid == 0 {
+		j.pgid = pid
+	}
+	j.pids = append(j.pids, pid)
+	j.startMu.Do(func() { close(j.started) })
+	return nil
+}
+
+// watch follows a process of the job through stops and continues until it
+// exits. It leaves the process to be reaped by exec.Cmd.Wait.
+func (j *job) watch(pid int) {
+	for {
+		var info unix.Siginfo
+		err := unix.Waitid(unix.P_PID, pid, &info, unix.WEXITED|unix.WSTOPPED|unix.WCONTINUED|unix.WNOWAIT, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		switch info.Code {
+		case cldStopped:
+			// take the stop off the queue; the exit stays for Wait
+			unix.Waitid(unix.P_PID, pid, &info, unix.WSTOPPED|unix.WNOHANG, nil)
+			j.setStopped(pid, true)
+		case cldContinued:
+			unix.Waitid(unix.P_PID, pid, &info, unix.WCONTINUED|unix.WNOHANG, nil)
+			j.setStopped(pid, false)
+		default:
+			return
+		}
+	}
+}
+
+func (j *job) setStopped(pid int, stopped bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if stopped {
+		j.stopped[pid] = true
+	} else {
+		delete(j.stopped, pid)
+	}
+	if j.state != jobDone {
+		j.setState(jobRunning)
+		if len(j.stopped) > 0 {
+			j.setState(jobStopped)
+		}
+	}
+}
+
+// setState must be called with mu held.
+func (j *job) setState(state jobState) {
+	if j.state == state {
+		return
+	}
+	j.state = state
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// finish marks the job done, with the statuses of its commands.
+func (j *job) finish(statuses []command.Result) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.statuses = statuses
+	j.setState(jobDone)
+	j.startMu.Do(func() { close(j.started) })
+}
+
+// waitWhile blocks while the job is in state, or until ctx is done, and
+// returns the state it is in then.
+func (j *job) waitWhile(ctx context.Context, state jobState) jobState {
+	for {
+		j.mu.Lock()
+		current, changed := j.state, j.changed
+		j.mu.Unlock()
+		if current != state {
+			return current
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return current
+		}
+	}
+}
+
+// resume sends the job SIGCONT, counting it as running straight away.
+func (j *job) resume() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.state != jobStopped {
+		return nil
+	}
+	clear(j.stopped)
+	j.setState(jobRunning)
+	return unix.Kill(-j.pgid, unix.SIGCONT)
+}
+
+func (j *job) signal(sig syscall.Signal) {
+	j.mu.Lock()
+	pgid := j.pgid
+	j.mu.Unlock()
+	if pgid != 0 {
+		unix.Kill(-pgid, sig)
+	}
+}
+
+// lastPid returns the process started last in the job, or 0 if it has
+// started none yet.
+func (j *job) lastPid() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.pids) == 0 {
+		return 0
+	}
+	return j.pids[len(j.pids)-1]
+}
+
+func (j *job) status() command.Result {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.statuses) == 0 {
+		return command.Ok
+	}
+	return j.statuses[len(j.statuses)-1]
+}
+
+// info describes the job for the builtins.
+func (j *job) info(mark string) command.Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	state := "Running"
+	switch j.state {
+	case jobStopped:
+		state = "Stopped"
+	case jobDone:
+		state = doneState(j.statuses[len(j.statuses)-1])
+	}
+	return command.Job{
+		ID:    j.id,
+		Mark:  mark,
+		State: state,
+		Text:  j.text,
+		Pgid:  j.pgid,
+		PIDs:  slices.Clone(j.pids),
+	}
+}
+
+// doneState describes how a job ended: Done, Exit N, or for a job killed by
+// a signal the signal, as in Terminated.
+func doneState(status command.Result) string {
+	switch {
+	case status == command.Ok:
+		return "Done"
+	case status > 128 && status < 128+65:
+		name := syscall.Signal(status - 128).String()
+		return strings.ToUpper(name[:1]) + name[1:]
+	default:
+		return fmt.Sprintf("Exit %d", status)
+	}
+}
+
+/* =========================
+        JOB TABLE
+========================= */
+
+// jobTable holds the jobs the user can refer to with %n. The current job,
+// the one fg and bg default to, is the last one.
+type jobTable struct {
+	mu   sync.Mutex
+	jobs []*job
+}
+
+func (t *jobTable) add(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := 1
+	for _, other := range t.jobs {
+		id = max(id, other.id+1)
+	}
+	j.mu.Lock()
+	j.id = id
+	j.mu.Unlock()
+	t.jobs = append(t.jobs, j)
+}
+
+// touch makes j the current job.
+func (t *jobTable) touch(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i := slices.Index(t.jobs, j); i >= 0 {
+		t.jobs = append(slices.Delete(t.jobs, i, i+1), j)
+	}
+}
+
+func (t *jobTable) remove(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i := slices.Index(t.jobs, j); i >= 0 {
+		t.jobs = slices.Delete(t.jobs, i, i+1)
+	}
+}
+
+// list returns the jobs by number, each with its mark.
+func (t *jobTable) list() ([]*job, []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	marks := make(map[*job]string, len(t.jobs))
+	for i, j := range t.jobs {
+		switch i {
+		case len(t.jobs) - 1:
+			marks[j] = "+"
+		case len(t.jobs) - 2:
+			marks[j] = "-"
+		default:
+			marks[j] = " "
+		}
+	}
+	jobs := slices.SortedFunc(slices.Values(t.jobs), func(a, b *job) int {
+		return a.id - b.id
+	})
+	list := make([]string, len(jobs))
+	for i, j := range jobs {
+		list[i] = marks[j]
+	}
+	return jobs, list
+}
+
+// lookup finds the job spec names: %n, %% or %+ for the current job, %- for
+// the previous one, %text for the job whose command starts with text, or
+// the id of one of its processes. An empty spec is the current job.
+func (t *jobTable) lookup(spec string) (*job, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pick := func(i int) (*job, error) {
+		if i < 0 || i >= len(t.jobs) {
+			if spec == "" {
+				spec = "current"
+			}
+			return nil, fmt.Errorf("%s: no such job", spec)
+		}
+		return t.jobs[i], nil
+	}
+	switch spec {
+	case "", "%", "%%", "%+":
+		return pick(len(t.jobs) - 1)
+	case "%-":
+		return pick(len(t.jobs) - 2)
+	}
+
+	if !strings.HasPrefix(spec, "%") {
+		pid, err := strconv.Atoi(spec)
+		if err != nil {
+			return nil, fmt.Errorf("`%s': not a pid or valid job spec", spec)
+		}
+		for _, j := range t.jobs {
+			j.mu.Lock()
+			found := slices.Contains(j.pids, pid)
+			j.mu.Unlock()
+			if found {
+				return j, nil
+			}
+		}
+		return nil, fmt.Errorf("pid %d is not a child of this shell", pid)
+	}
+
+	name := spec[1:]
+	if n, err := strconv.Atoi(name); err == nil {
+		for _, j := range t.jobs {
+			if j.id == n {
+				return j, nil
+			}
+		}
+	} else {
+		for i := len(t.jobs) - 1; i >= 0; i-- {
+			if strings.HasPrefix(t.jobs[i].text, name) {
+				return t.jobs[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s: no such job", spec)
+}
+
+/* =========================
+        JOB CONTROL
+========================= */
+
+// initJobControl turns job control on when the shell reads from a
+// terminal: the shell leads a process group of its own, which owns the
+// terminal whenever no foreground job does.
+func (s *Shell) initJobControl() {
+	tty := int(os.Stdin.Fd())
+	if !term.IsTerminal(tty) {
+		return
+	}
+	unix.Setpgid(0, 0)
+	s.pgid = unix.Getpgrp()
+	if err := setForeground(tty, s.pgid); err != nil {
+		return
+	}
+	s.tty = tty
+	s.modes, _ = term.GetState(tty)
+
+	// Ctrl-Z while a builtin runs must not stop the shell. Catching the
+	// signal rather than ignoring it lets programs started later stop.
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGTSTP)
+}
+
+// setForeground hands the terminal to the process group pgid. The shell
+// does this from the background, so SIGTTOU is blocked for the call.
+func setForeground(tty, pgid int) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var block, old unix.Sigset_t
+	block.Val[0] = 1 << (uint(unix.SIGTTOU) - 1)
+	unix.PthreadSigmask(unix.SIG_BLOCK, &block, &old)
+	defer unix.PthreadSigmask(unix.SIG_SETMASK, &old, nil)
+	return unix.IoctlSetPointerInt(tty, unix.TIOCSPGRP, pgid)
+}
+
+// waitForeground waits for j while it owns the terminal, until it ends or
+// stops, then takes the terminal back. A job that stops goes in the table.
+func (s *Shell) waitForeground(j *job) jobState {
+	s.foreground.Store(j)
+	state := j.waitWhile(context.Background(), jobRunning)
+	s.foreground.Store(nil)
+
+	j.mu.Lock()
+	j.foreground = false
+	if state == jobStopped {
+		j.modes, _ = term.GetState(s.tty)
+	}
+	j.mu.Unlock()
+	setForeground(s.tty, s.pgid)
+	if s.modes != nil {
+		term.Restore(s.tty, s.modes)
+	}
+
+	if state == jobStopped {
+		if j.id == 0 {
+			s.jobs.add(j)
+		}
+		s.jobs.touch(j)
+		j.reported = jobStopped
+		fmt.Println()
+		fmt.Println(j.info("+"))
+	}
+	if state == jobDone {
+		j.mu.Lock()
+		statuses := j.statuses
+		j.mu.Unlock()
+		if s.interruptedBy(statuses) {
+			// the terminal echoed ^C; the prompt goes on a line of its own
+			fmt.Println()
+		}
+	}
+	return state
+}
+
+// runForeground starts the runners of a pipeline as the job j and waits
+// for them with j in the foreground. When j stops, its statuses are
+// 128+SIGTSTP and the runners go on being waited for in the background.
+func (s *Shell) runForeground(j *job, runners []runner) []command.Result {
+	go func() {
+		statuses := make([]command.Result, len(runners))
+		for i, r := range runners {
+			statuses[i] = r.wait()
+		}
+		j.finish(statuses)
+	}()
+
+	if s.waitForeground(j) == jobStopped {
+		return []command.Result{command.Result(128 + int(syscall.SIGTSTP))}
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.statuses
+}
+
+// executeBackground starts an and-or list ending in & as a job in a
+// subshell of its own and returns without waiting for it.
+func (s *Shell) executeBackground(ctx context.Context, andOr *parser.AndOr, base *shellruntime.IOContext) {
+	j := newJob(strings.TrimSuffix(andOr.String(), " &"))
+	fds := base.Clone()
+	if s.tty < 0 {
+		// without job control nothing stops it reading the terminal
+		if devNull, err := os.Open(os.DevNull); err == nil {
+			fds.Set(0, shellruntime.ReaderFD(devNull))
+			defer devNull.Close()
+		}
+	}
+
+	// the job outlives the command line, and SIGINT does not reach it
+	ctx = context.WithoutCancel(ctx)
+	sub, end := s.subshell(fds)
+	sub.job = j
+	sub.interrupted = new(atomic.Bool)
+	s.jobs.add(j)
+	go func() {
+		defer end()
+		defer fds.Close()
+		sub.executeAndOr(ctx, andOr, fds)
+		j.finish([]command.Result{sub.status})
+	}()
+
+	s.lastBackground = j
+	if s.startsProgram(andOr) {
+		// a program starts at once, and [n] can give its process ID; a
+		// list run inside the shell may not start one for a long time
+		<-j.started
+	}
+	j.mu.Lock()
+	id := j.id
+	j.mu.Unlock()
+	if pid := j.lastPid(); pid != 0 {
+		fmt.Printf("[%d] %d\n", id, pid)
+	} else {
+		fmt.Printf("[%d]\n", id)
+	}
+	s.status = command.Ok
+}
+
+// startsProgram reports whether the first pipeline of andOr runs a
+// program, as a simple command naming neither a function nor a builtin.
+func (s *Shell) startsProgram(andOr *parser.AndOr) bool {
+	for _, cmd := range andOr.Pipelines[0].Commands {
+		line, ok := cmd.(*parser.CommandLine)
+		if ok && len(line.Words) > 0 && !s.runsInShell(stage{name: line.Words[0].Value}) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportJobs tells the user about jobs that stopped or finished since the
+// last prompt. Finished jobs leave the table.
+func (s *Shell) reportJobs() {
+	jobs, marks := s.jobs.list()
+	for i, j := range jobs {
+		j.mu.Lock()
+		state, reported := j.state, j.reported
+		j.reported = state
+		j.mu.Unlock()
+		if state == reported || state == jobRunning {
+			continue
+		}
+		fmt.Println(j.info(marks[i]))
+		if state == jobDone {
+			s.jobs.remove(j)
+		}
+	}
+}
+
+/* =========================
+      JOB BUILTINS
+========================= */
+
+var errNoJobControl = errors.New("no job control")
+
+// Jobs lists the job table, for jobs. Having been listed, finished jobs
+// leave the table.
+func (s *Shell) Jobs() []command.Job {
+	jobs, marks := s.jobs.list()
+	infos := make([]command.Job, len(jobs))
+	for i, j := range jobs {
+		infos[i] = j.info(marks[i])
+		j.mu.Lock()
+		j.reported = j.state
+		done := j.state == jobDone
+		j.mu.Unlock()
+		if done {
+			s.jobs.remove(j)
+		}
+	}
+	return infos
+}
+
+// LookupJob finds a job by its spec, for fg, bg, wait, disown and kill.
+func (s *Shell) LookupJob(spec string) (command.Job, error) {
+	j, err := s.jobs.lookup(spec)
+	if err != nil {
+		return command.Job{}, err
+	}
+	jobs, marks := s.jobs.list()
+	return j.info(marks[slices.Index(jobs, j)]), nil
+}
+
+func (s *Shell) jobByID(id int) (*job, error) {
+	return s.jobs.lookup("%" + strconv.Itoa(id))
+}
+
+// Foreground continues job id with the terminal, for fg, and waits for it.
+func (s *Shell) Foreground(id int) (command.Result, error) {
+	if s.tty < 0 {
+		return command.Error, errNoJobControl
+	}
+	j, err := s.jobByID(id)
+	if err != nil {
+		return command.Error, err
+	}
+	s.jobs.touch(j)
+
+	j.mu.Lock()
+	j.foreground = true
+	if j.modes != nil {
+		term.Restore(s.tty, j.modes)
+	}
+	if j.pgid != 0 {
+		setForeground(s.tty, j.pgid)
+	}
+	j.mu.Unlock()
+	if err := j.resume(); err != nil {
+		return command.Error, err
+	}
+
+	if s.waitForeground(j) == jobStopped {
+		return command.Result(128 + int(syscall.SIGTSTP)), nil
+	}
+	s.jobs.remove(j)
+	return j.status(), nil
+}
+
+// Background continues the stopped job id without the terminal, for bg.
+func (s *Shell) Background(id int) error {
+	if s.tty < 0 {
+		return errNoJobControl
+	}
+	j, err := s.jobByID(id)
+	if err != nil {
+		return err
+	}
+	s.jobs.touch(j)
+	j.mu.Lock()
+	j.reported = jobRunning
+	j.mu.Unlock()
+	return j.resume()
+}
+
+// WaitJob waits for job id to finish, for wait, and takes it out of the
+// table. It gives up when ctx is done.
+func (s *Shell) WaitJob(ctx context.Context, id int) (command.Result, error) {
+	j, err := s.jobByID(id)
+	if err != nil {
+		return command.Error, err
+	}
+	for j.waitWhile(ctx, jobRunning) == jobStopped {
+		// a stopped job may still be continued by kill or bg
+		if j.waitWhile(ctx, jobStopped) != jobRunning {
+			break
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return command.Error, err
+	}
+	s.jobs.remove(j)
+	return j.status(), nil
+}
+
+// Disown takes job id out of the table, for disown.
+func (s *Shell) Disown(id int) {
+	if j, err := s.jobByID(id); err == nil {
+		s.jobs.remove(j)
+	}
+}
@@ -0,0 +1,178 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/command"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	shellruntime "github.com/codecrafters-io/shell-starter-go/internal/runtime"
+)
+
+/* =========================
+          LOOPS
+========================= */
+
+// flow says how the commands that are running should wind up. break and
+// continue set it; lists stop at once, and the loops they belong to clear it.
+type flow int
+
+const (
+	flowNext flow = iota
+	flowBreak
+	flowContinue
+	flowReturn // set by return; stops everything up to the function call
+)
+
+var errNotInLoop = errors.New("only meaningful in a `for', `while', or `until' loop")
+
+// Break and Continue back the builtins of the same name.
+func (s *Shell) Break(levels int) error {
+	return s.jump(flowBreak, levels)
+}
+
+func (s *Shell) Continue(levels int) error {
+	return s.jump(flowContinue, levels)
+}
+
+func (s *Shell) jump(f flow, levels int) error {
+	if s.loops == 0 {
+		return errNotInLoop
+	}
+	s.flow = f
+	s.flowLevels = min(levels, s.loops)
+	return nil
+}
+
+// unwinding reports whether the running commands must stop early.
+func (s *Shell) unwinding() bool {
+	return s.exiting || s.flow != flowNext || s.interrupted.Load() || s.pipeBroken()
+}
+
+// pipeBroken reports whether the pipeline stage the shell runs has lost
+// the reader of its output.
+func (s *Shell) pipeBroken() bool {
+	return s.brokenPipe != nil && s.brokenPipe.Load()
+}
+
+// endIteration is called by a loop after its body, or its condition, has
+// run. It settles a break or continue meant for this loop and reports
+// whether the loop must stop.
+func (s *Shell) endIteration() bool {
+	if s.flow == flowNext {
+		return s.exiting || s.interrupted.Load() || s.pipeBroken()
+	}
+	if s.flow == flowReturn {
+		return true
+	}
+	if s.flowLevels > 1 {
+		// meant for an outer loop
+		s.flowLevels--
+		return true
+	}
+	stop := s.flow == flowBreak
+	s.flow = flowNext
+	return stop
+}
+
+func (s *Shell) executeWhile(ctx context.Context, loop *parser.WhileLoop, fds *shellruntime.IOContext) command.Result {
+	s.loops++
+	defer func() { s.loops-- }()
+
+	status := command.Ok
+	for {
+		s.conditions++
+		s.executeList(ctx, loop.Cond, fds)
+		s.conditions--
+		if s.unwinding() {
+			if s.endIteration() {
+				break
+			}
+			continue
+		}
+		if (s.status == command.Ok) == loop.Until {
+			break
+		}
+
+		s.executeList(ctx, loop.Body, fds)
+		status = s.status
+		if s.endIteration() {
+			break
+		}
+	}
+	return status
+}
+
+func (s *Shell) executeFor(ctx context.Context, loop *parser.ForLoop, fds *shellruntime.IOContext) command.Result {
+	var words []string
+	if loop.In {
+		var err error
+		if words, err = s.newExpander(ctx, fds).ExpandWords(loop.Words); err != nil {
+			fmt.Fprintln(fds.Stderr(), err)
+			return command.Error
+		}
+	} else {
+		words, _ = s.LookupArray("@")
+	}
+
+	s.loops++
+	defer func() { s.loops-- }()
+
+	status := command.Ok
+	for _, word := range words {
+		if err := s.SetVar(loop.Name, word); err != nil {
+			fmt.Fprintln(fds.Stderr(), err)
+			return command.Error
+		}
+		s.executeList(ctx, loop.Body, fds)
+		status = s.status
+		if s.endIteration() {
+			break
+		}
+	}
+	return status
+}
+
+func (s *Shell) executeArithFor(ctx context.Context, loop *parser.ArithForLoop, fds *shellruntime.IOContext) command.Result {
+	expander := s.newExpander(ctx, fds)
+	eval := func(expr string) (int64, bool) {
+		if strings.TrimSpace(expr) == "" {
+			return 1, true
+		}
+		value, err := expander.Arithmetic(expr)
+		if err != nil {
+			fmt.Fprintf(fds.Stderr(), "((: %v\n", err)
+			return 0, false
+		}
+		return value, true
+	}
+
+	s.loops++
+	defer func() { s.loops-- }()
+
+	status := command.Ok
+	if _, ok := eval(loop.Init); !ok {
+		return command.Error
+	}
+	for {
+		cond, ok := eval(loop.Cond)
+		if !ok {
+			return command.Error
+		}
+		if cond == 0 {
+			break
+		}
+
+		s.executeList(ctx, loop.Body, fds)
+		status = s.status
+		if s.endIteration() {
+			break
+		}
+		if _, ok := eval(loop.Step); !ok {
+			return command.Error
+		}
+	}
+	return status
+}
@@ -1,17 +1,23 @@
 package shell
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+
 	"github.com/codecrafters-io/shell-starter-go/internal/command"
 	"github.com/codecrafters-io/shell-starter-go/internal/editor"
 	"github.com/codecrafters-io/shell-starter-go/internal/history"
@@ -22,47 +28,153 @@ import (
 
 type Shell struct {
 	commands map[string]command.Command
-	history  *history.Store
+	// builtins makes the builtin commands for a shell and its subshells.
+	builtins  func(*Shell) map[string]command.Command
+	functions map[string]*parser.FunctionDef
+	vars      map[string]*variable
+	// frames holds a frame per running function call, innermost last.
+	frames  []*frame
+	history *history.Store
+	// dir is the working directory. The shell keeps it rather than the
+	// process, so that shells sharing a process each have their own.
+	dir string
+	// fds is the shell's own descriptor table; exec with only redirections
+	// changes it, and every command starts from a copy of it.
+	fds *shellruntime.IOContext
+	// status is $?, the status of the last pipeline.
+	status command.Result
+	// substStatus is the status of the last command substitution in the
+	// command being expanded, which a bare assignment ends with.
+	substStatus command.Result
+	// pipeStatus is PIPESTATUS, the status of every command in the last
+	// pipeline.
+	pipeStatus []command.Result
+	// exiting is set by the exit builtin; the shell stops before running
+	// anything else.
+	exiting bool
+	options map[string]bool // set -o
+	jobs    *jobTable
+	// job is the job the processes the shell starts belong to: the
+	// foreground pipeline running, or in a subshell the enclosing job.
+	job *job
+	// tty is the terminal when job control is on, and -1 otherwise; pgid is
+	// the shell's own process group and modes its terminal settings.
+	tty   int
+	pgid  int
+	modes *term.State
+	// lastBackground is the last job started with &; $! is the process
+	// it started last, once it has started one.
+	lastBackground *job
+	// foreground is the job that owns the terminal, for SIGINT and SIGQUIT
+	// to be passed on to.
+	foreground atomic.Pointer[job]
+	// interrupted is set when SIGINT stops the command line running; the
+	// subshells it runs share it. cancel cancels the command line's
+	// context, under mu.
+	interrupted *atomic.Bool
+	// brokenPipe is set for a pipeline stage run inside the shell once the
+	// stage after it stops reading; like a program killed by SIGPIPE, the
+	// stage then stops. Its subshells share it.
+	brokenPipe *atomic.Bool
+	mu         sync.Mutex
+	cancel     context.CancelFunc
+	// busy is held while a command line runs, so that a signal arriving
+	// at the prompt can be dealt with at once.
+	busy      sync.Mutex
+	exitHooks []func()
+	exitOnce  sync.Once
+	// traps maps a signal name, such as SIGINT or EXIT, to the commands
+	// trapped on it, under mu. pending holds the signals whose traps are
+	// still to run, and sigs is where trapped signals arrive.
+	traps   map[string]string
+	pending []syscall.Signal
+	sigs    chan os.Signal
+	// lineEditor reads the command lines, for a trap run at the prompt to
+	// draw the prompt again.
+	lineEditor *editor.LineEditor
+	// inTrap is set while a trap runs; conditions counts the if and while
+	// conditions running, whose failures the ERR trap ignores.
+	inTrap     bool
+	conditions int
+	// flow is a break or continue on its way out to the loop it belongs to,
+	// flowLevels loops further out; loops counts the loops running.
+	flow       flow
+	flowLevels int
+	loops      int
 }
 
 type runner struct {
 	start func() error
-	wait  func()
+	wait  func() command.Result
+}
+
+// stage is a pipeline command after word expansion.
+type stage struct {
+	name string
+	args []string
+	// assigns are the NAME=value words in front of the name. They expand
+	// as they are made, each after the ones before it.
+	assigns []lexer.Token
+	redirs  []shellruntime.Redirect
+	arith   *lexer.Token // set for a (( expr )) command
+	// compound is set for a compound command such as if
+	compound parser.Node
+	// define is set for a function definition
+	define *parser.FunctionDef
 }
 
 type pipeSetup struct {
 	ioCtx      *shellruntime.IOContext
-	pipeWriter *io.PipeWriter
+	pipeWriter io.WriteCloser
 	closeStdin io.Closer
 	closePipe  bool
 }
 
-func New(commands map[string]command.Command, historyStore *history.Store) *Shell {
-	return &Shell{
-		commands: commands,
-		history:  historyStore,
+// New makes a shell with the builtin commands returned by builtins, which is
+// called again for every subshell.
+func New(builtins func(*Shell) map[string]command.Command, historyStore *history.Store) *Shell {
+	s := &Shell{
+		builtins:  builtins,
+		functions: make(map[string]*parser.FunctionDef),
+		vars:      environVars(),
+		history:   historyStore,
+		dir:       startDir(),
+		fds:       shellruntime.NewIOContext(),
+		options: map[string]bool{
+			"pipefail":  false,
+			"noclobber": false,
+		},
+		jobs:        &jobTable{},
+		tty:         -1,
+		interrupted: new(atomic.Bool),
+		traps:       make(map[string]string),
 	}
+	s.commands = builtins(s)
+	s.initJobControl()
+	return s
 }
 
 /* =========================
          RUN
 ========================= */
 
-func (s *Shell) Run() {
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
-
+// Run reads and runs commands until exit, and returns the status the shell
+// should exit with.
+func (s *Shell) Run() int {
 	editor := editor.New(s.builtinNames(), s.executablesInPath())
+	s.lineEditor = editor
 
-	for {
-		fmt.Print("$ ")
-		os.Stdout.Sync()
+	stop := s.handleSignals()
+	defer stop()
+	defer s.runExitHooks()
 
+	for {
+		s.reportJobs()
 		if s.history != nil {
 			editor.SetHistory(s.history.List())
 		}
 
-		line, err := editor.ReadLine()
+		line, err := s.readCommand(editor)
 		if err != nil {
 			fmt.Println(err)
 			continue
@@ -72,57 +184,182 @@ func (s *Shell) Run() {
 			s.history.Add(line)
 		}
 
-		tokens := lexer.Tokenize(line)
-		commands, err := parser.ParsePipeline(tokens)
+		tokens, err := lexer.Tokenize(line)
 		if err != nil {
 			fmt.Println(err)
 			continue
 		}
-		if len(commands) == 0 {
+		list, err := parser.Parse(tokens)
+		if err != nil {
+			fmt.Println(err)
 			continue
 		}
-		shouldExit := s.executePipeline(ctx, commands)
-		if shouldExit {
-			return
+		s.runLine(func(ctx context.Context) {
+			s.executeList(ctx, list, s.fds)
+		})
+		if s.exiting {
+			// the EXIT trap may exit with another status
+			s.runExitHooks()
+			return int(s.status)
 		}
 	}
 }
 
+// readCommand reads a line and, while it ends inside an unfinished construct
+// such as an open quote, a here-document or a trailing &&, keeps reading more
+// lines.
+func (s *Shell) readCommand(ed *editor.LineEditor) (string, error) {
+	prompt := "$ "
+	var text string
+	for {
+		ed.SetPrompt(prompt)
+		fmt.Print(prompt)
+		os.Stdout.Sync()
+
+		line, err := ed.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if prompt == "$ " {
+			text = line
+		} else {
+			text += "\n" + line
+		}
+
+		tokens, err := lexer.Tokenize(text)
+		if err == nil {
+			_, err = parser.Parse(tokens)
+		}
+		if !parser.IsIncomplete(err) {
+			return text, nil
+		}
+		prompt = "> "
+	}
+}
+
 /* =========================
       EXECUTION
 ========================= */
 
-func (s *Shell) executePipeline(ctx context.Context, pipeline []parser.CommandLine) bool {
-	var exitRequested int32
+// executeList runs each and-or list in turn, stopping early when one of
+// them exits the shell or leaves a loop. Lists ending in & start as jobs.
+func (s *Shell) executeList(ctx context.Context, list *parser.List, base *shellruntime.IOContext) {
+	for _, andOr := range list.Items {
+		if andOr.Background {
+			s.executeBackground(ctx, andOr, base)
+			continue
+		}
+		s.executeAndOr(ctx, andOr, base)
+		if s.unwinding() {
+			return
+		}
+	}
+}
+
+// executeAndOr runs the first pipeline, then each following one whose
+// operator agrees with $?: && after success, || after failure.
+func (s *Shell) executeAndOr(ctx context.Context, andOr *parser.AndOr, base *shellruntime.IOContext) {
+	s.setStatus(s.executePipeline(ctx, andOr.Pipelines[0].Commands, base))
+	s.runTraps(ctx, base)
+	last := 0
+	for i, op := range andOr.Ops {
+		if s.unwinding() {
+			return
+		}
+		if (op == "&&") != (s.status == command.Ok) {
+			continue
+		}
+		s.setStatus(s.executePipeline(ctx, andOr.Pipelines[i+1].Commands, base))
+		s.runTraps(ctx, base)
+		last = i + 1
+	}
+	// only the pipeline after the last operator fails for good
+	if last == len(andOr.Ops) && s.status != command.Ok && !s.unwinding() {
+		s.trapError(ctx, andOr.Pipelines[last], base)
+	}
+}
 
-	runners := make([]runner, 0, len(pipeline))
+// executePipeline runs one pipeline and returns the status of each of its
+// commands. Its commands start from the descriptors in base.
+func (s *Shell) executePipeline(ctx context.Context, pipeline []parser.Command, base *shellruntime.IOContext) []command.Result {
+	s.trapDebug(ctx, pipeline, base)
+	expander := s.newExpander(ctx, base)
+	s.substStatus = command.Ok
+	stages := make([]stage, 0, len(pipeline))
+	for _, cmd := range pipeline {
+		st, err := s.expandCommand(expander, cmd)
+		if err != nil {
+			fmt.Fprintln(base.Stderr(), err)
+			return []command.Result{command.Error}
+		}
+		stages = append(stages, st)
+	}
+	if len(stages) == 1 && isBare(stages[0]) {
+		// the redirections still create their files
+		fds := base.Clone()
+		err := fds.Apply(stages[0].redirs)
+		fds.Close()
+		if err != nil {
+			fmt.Fprintln(base.Stderr(), err)
+			return []command.Result{command.Error}
+		}
+		if err := s.assign(expander, stages[0].assigns); err != nil {
+			fmt.Fprintln(base.Stderr(), err)
+			return []command.Result{command.Error}
+		}
+		return []command.Result{s.substStatus}
+	}
+	if len(stages) == 1 && s.isExecRedirect(stages[0]) {
+		// exec without a command keeps its redirections for the whole shell
+		if err := s.fds.Apply(stages[0].redirs); err != nil {
+			fmt.Fprintln(base.Stderr(), err)
+			return []command.Result{command.Error}
+		}
+		return []command.Result{command.Ok}
+	}
+
+	// with job control, a pipeline that runs programs is a job of its own
+	var fg *job
+	if s.job == nil && s.tty >= 0 && (len(stages) > 1 || !s.runsInShell(stages[0])) {
+		fg = newJob((&parser.Pipeline{Commands: pipeline}).String())
+		fg.foreground, fg.tty = true, s.tty
+		s.job = fg
+		defer func() { s.job = nil }()
+	}
 
-	var prevReader io.Reader = os.Stdin
+	runners := make([]runner, 0, len(stages))
 
-	for i, cmdLine := range pipeline {
-		var pipeReader *io.PipeReader
-		var pipeWriter *io.PipeWriter
-		if i < len(pipeline)-1 {
-			pipeReader, pipeWriter = io.Pipe()
+	var prevReader io.Reader
+
+	for i, st := range stages {
+		var pipeReader io.ReadCloser
+		var pipeWriter io.WriteCloser
+		if i < len(stages)-1 {
+			var err error
+			if pipeReader, pipeWriter, err = s.newPipe(st, stages[i+1]); err != nil {
+				fmt.Fprintln(base.Stderr(), err)
+				return []command.Result{command.Error}
+			}
 		}
 
-		setup, err := s.preparePipelineIO(prevReader, pipeWriter, cmdLine.Redir)
+		setup, err := s.preparePipelineIO(base, prevReader, pipeWriter, st.redirs)
 		if err != nil {
-			fmt.Println(err)
-			return false
+			fmt.Fprintln(base.Stderr(), err)
+			return []command.Result{command.Error}
 		}
 
-		if builtin, ok := s.commands[cmdLine.Name]; ok {
-			runners = append(runners, s.newBuiltinRunner(ctx, builtin, cmdLine.Args, setup, &exitRequested))
-		} else if path, ok := s.IsExecutable(cmdLine.Name); ok {
-			runners = append(runners, s.newExternalRunner(ctx, path, cmdLine.Args, cmdLine.Name, setup))
-		} else {
-			fmt.Println(cmdLine.Name + ": command not found")
-			if setup.pipeWriter != nil {
-				setup.pipeWriter.Close()
+		if len(stages) > 1 && s.runsInShell(st) {
+			// each stage of a pipeline is a subshell, so that cd /tmp | cat
+			// leaves this shell where it was
+			sub, end := s.subshell(setup.ioCtx)
+			r := sub.newRunner(ctx, st, setup)
+			if w, ok := setup.pipeWriter.(*memPipeWriter); ok {
+				sub.brokenPipe = &w.broken
+				r = stopOnBrokenPipe(r, &w.broken)
 			}
-			setup.ioCtx.Close()
-			return false
+			runners = append(runners, restoreAfter(r, end))
+		} else {
+			runners = append(runners, s.newRunner(ctx, st, setup))
 		}
 
 		if pipeReader != nil {
@@ -132,28 +369,198 @@ func (s *Shell) executePipeline(ctx context.Context, pipeline []parser.CommandLi
 
 	for i, r := range runners {
 		if err := r.start(); err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(base.Stderr(), err)
 			for j := 0; j < i; j++ {
 				runners[j].wait()
 			}
-			return false
+			return []command.Result{command.Error}
 		}
 	}
 
-	for _, r := range runners {
-		r.wait()
+	if fg != nil {
+		return s.runForeground(fg, runners)
+	}
+	statuses := make([]command.Result, len(runners))
+	for i, r := range runners {
+		statuses[i] = r.wait()
+	}
+
+	return statuses
+}
+
+// newRunner picks how to run an expanded stage, whose descriptors are set
+// up already.
+func (s *Shell) newRunner(ctx context.Context, st stage, setup pipeSetup) runner {
+	if st.define != nil {
+		s.functions[st.define.Name] = st.define
+		return s.newFinishedRunner(command.Ok, "", setup)
+	}
+	if isBare(st) {
+		if err := s.assign(s.newExpander(ctx, setup.ioCtx), st.assigns); err != nil {
+			return s.newFinishedRunner(command.Error, err.Error(), setup)
+		}
+		return s.newFinishedRunner(s.substStatus, "", setup)
 	}
+	if st.compound != nil {
+		return s.newCompoundRunner(ctx, st.compound, setup)
+	}
+	if st.arith != nil {
+		arith := arithCommand{expander: s.newExpander(ctx, setup.ioCtx), expr: st.arith.Value}
+		return s.newBuiltinRunner(ctx, arith, nil, setup)
+	}
+
+	// the assignments hold while a function or builtin runs, and only go
+	// into the environment of a program
+	restore, err := s.assignTemp(s.newExpander(ctx, setup.ioCtx), st.assigns)
+	if err != nil {
+		return s.newFinishedRunner(command.Error, err.Error(), setup)
+	}
+	if fn, ok := s.functions[st.name]; ok {
+		return restoreAfter(s.newFunctionRunner(ctx, fn, st.args, setup), restore)
+	}
+	if builtin, ok := s.commands[st.name]; ok {
+		return restoreAfter(s.newBuiltinRunner(ctx, builtin, st.args, setup), restore)
+	}
+	defer restore()
+	path, status, msg := s.lookCommand(st.name)
+	if status != command.Ok {
+		return s.newFinishedRunner(status, msg, setup)
+	}
+	return s.newExternalRunner(path, st.args, st.name, setup)
+}
+
+// restoreAfter makes r call restore once it is done.
+func restoreAfter(r runner, restore func()) runner {
+	wait := r.wait
+	r.wait = func() command.Result {
+		defer restore()
+		return wait()
+	}
+	return r
+}
+
+// isBare reports whether st is nothing but assignments and redirections.
+func isBare(st stage) bool {
+	return st.name == "" && st.arith == nil && st.compound == nil && st.define == nil
+}
+
+// runsInShell reports whether st runs inside the shell rather than as a
+// separate program.
+func (s *Shell) runsInShell(st stage) bool {
+	_, isFunction := s.functions[st.name]
+	_, isBuiltin := s.commands[st.name]
+	return st.name == "" || isFunction || isBuiltin
+}
 
-	return atomic.LoadInt32(&exitRequested) == 1
+// setStatus keeps a pipeline's statuses as PIPESTATUS and sets $? from them:
+// the last one, or with pipefail the rightmost failure.
+func (s *Shell) setStatus(statuses []command.Result) {
+	s.pipeStatus = statuses
+	s.status = statuses[len(statuses)-1]
+	if s.options["pipefail"] {
+		for _, status := range statuses {
+			if status != command.Ok {
+				s.status = status
+			}
+		}
+	}
+}
+
+// captureOutput runs the text of a command substitution and returns
+// everything it wrote to stdout.
+func (s *Shell) captureOutput(ctx context.Context, src string, base *shellruntime.IOContext) (string, error) {
+	tokens, err := lexer.Tokenize(src)
+	if err != nil {
+		return "", err
+	}
+	list, err := parser.Parse(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	fds := base.Clone()
+	fds.Set(1, shellruntime.WriterFD(&out))
+
+	sub, end := s.subshell(fds)
+	// break can't reach the loops outside
+	sub.loops = 0
+	sub.executeList(ctx, list, fds)
+	// the subshell's EXIT trap writes to out too
+	end()
+	s.substStatus = sub.status
+	return out.String(), nil
+}
+
+// newExpander returns an expander whose command substitutions start from
+// the descriptors in base.
+func (s *Shell) newExpander(ctx context.Context, base *shellruntime.IOContext) *lexer.Expander {
+	return lexer.NewExpander(s, s.dir, func(src string) (string, error) {
+		return s.captureOutput(ctx, src, base)
+	})
+}
+
+func (s *Shell) expandCommand(expander *lexer.Expander, cmd parser.Command) (stage, error) {
+	var st stage
+	var redirs []parser.Redirect
+	switch cmd := cmd.(type) {
+	case *parser.CommandLine:
+		fields, err := expander.ExpandWords(cmd.Words)
+		if err != nil {
+			return stage{}, err
+		}
+		if len(fields) > 0 {
+			st.name, st.args = fields[0], fields[1:]
+		}
+		st.assigns = cmd.Assigns
+		st.arith = cmd.Arith
+		redirs = cmd.Redirs
+	case *parser.CompoundCommand:
+		// the body expands as it runs
+		st.compound = cmd.Body
+		redirs = cmd.Redirs
+	case *parser.FunctionDef:
+		// its redirections are for the calls
+		st.define = cmd
+	}
+
+	var err error
+	if st.redirs, err = s.expandRedirects(expander, redirs); err != nil {
+		return stage{}, err
+	}
+	return st, nil
+}
+
+func (s *Shell) expandRedirects(expander *lexer.Expander, redirs []parser.Redirect) ([]shellruntime.Redirect, error) {
+	var expanded []shellruntime.Redirect
+	for _, redir := range redirs {
+		target, err := expander.ExpandWord(redir.Target)
+		if err != nil {
+			return nil, err
+		}
+		if redir.Op == "<<<" {
+			target += "\n"
+		}
+		expanded = append(expanded, shellruntime.Redirect{
+			Op:        redir.Op,
+			FD:        redir.FD,
+			Target:    target,
+			Dir:       s.dir,
+			NoClobber: s.options["noclobber"],
+		})
+	}
+	return expanded, nil
 }
 
-func (s *Shell) preparePipelineIO(prevReader io.Reader, pipeWriter *io.PipeWriter, redir parser.Redirect) (pipeSetup, error) {
-	ioCtx := shellruntime.NewIOContext()
-	ioCtx.Stdin = prevReader
+func (s *Shell) preparePipelineIO(base *shellruntime.IOContext, prevReader io.Reader, pipeWriter io.WriteCloser, redirs []shellruntime.Redirect) (pipeSetup, error) {
+	ioCtx := base.Clone()
+	if prevReader != nil {
+		ioCtx.Set(0, shellruntime.ReaderFD(prevReader))
+	}
 	if pipeWriter != nil {
-		ioCtx.Stdout = pipeWriter
+		ioCtx.Set(1, shellruntime.WriterFD(pipeWriter))
 	}
-	if err := ioCtx.Apply(redir); err != nil {
+	if err := ioCtx.Apply(redirs); err != nil {
 		if pipeWriter != nil {
 			pipeWriter.Close()
 		}
@@ -161,17 +568,18 @@ func (s *Shell) preparePipelineIO(prevReader io.Reader, pipeWriter *io.PipeWrite
 		return pipeSetup{}, err
 	}
 
-	if pipeWriter != nil && ioCtx.Stdout != pipeWriter {
+	// the pipe may have been redirected away, or duplicated onto stderr
+	if pipeWriter != nil && !ioCtx.Writes(pipeWriter) {
 		pipeWriter.Close()
 		pipeWriter = nil
 	}
 
 	var closeStdin io.Closer
-	if r, ok := prevReader.(*io.PipeReader); ok {
+	if r, ok := prevReader.(io.Closer); ok {
 		closeStdin = r
 	}
 
-	closePipe := pipeWriter != nil && ioCtx.Stdout == pipeWriter
+	closePipe := pipeWriter != nil
 
 	return pipeSetup{
 		ioCtx:      ioCtx,
@@ -181,6 +589,62 @@ func (s *Shell) preparePipelineIO(prevReader io.Reader, pipeWriter *io.PipeWrite
 	}, nil
 }
 
+// newPipe makes the pipe from stage from to stage to. Between two programs
+// it is a kernel pipe, which they use directly; a builtin or other command
+// run inside the shell gets an in-memory one instead.
+func (s *Shell) newPipe(from, to stage) (io.ReadCloser, io.WriteCloser, error) {
+	if s.runsInShell(from) || s.runsInShell(to) {
+		r, w := io.Pipe()
+		return r, &memPipeWriter{PipeWriter: w}, nil
+	}
+	return os.Pipe()
+}
+
+// memPipeWriter is the write end of an in-memory pipe. It notes a write
+// made after the read end was closed, which is where a kernel pipe would
+// raise SIGPIPE.
+type memPipeWriter struct {
+	*io.PipeWriter
+	broken atomic.Bool
+}
+
+func (w *memPipeWriter) Write(p []byte) (int, error) {
+	n, err := w.PipeWriter.Write(p)
+	if errors.Is(err, io.ErrClosedPipe) {
+		w.broken.Store(true)
+	}
+	return n, err
+}
+
+// stopOnBrokenPipe makes r end with status 141, as SIGPIPE would, when
+// its stage wrote to a pipe nothing read any more.
+func stopOnBrokenPipe(r runner, broken *atomic.Bool) runner {
+	wait := r.wait
+	r.wait = func() command.Result {
+		status := wait()
+		if broken.Load() {
+			return command.BrokenPipe
+		}
+		return status
+	}
+	return r
+}
+
+// releaseFiles closes the shell's own copies of the kernel pipes a program
+// was started with. The program then holds the only ones: it sees EOF once
+// the stage before it exits, and gets SIGPIPE once the stage after it does.
+func releaseFiles(setup pipeSetup) pipeSetup {
+	if f, ok := setup.pipeWriter.(*os.File); ok && setup.closePipe {
+		f.Close()
+		setup.closePipe = false
+	}
+	if f, ok := setup.closeStdin.(*os.File); ok {
+		f.Close()
+		setup.closeStdin = nil
+	}
+	return setup
+}
+
 func (s *Shell) closePipelineIO(setup pipeSetup) {
 	if setup.closePipe {
 		setup.pipeWriter.Close()
@@ -196,7 +660,6 @@ func (s *Shell) newBuiltinRunner(
 	builtin command.Command,
 	args []string,
 	setup pipeSetup,
-	exitFlag *int32,
 ) runner {
 	done := make(chan command.Result, 1)
 
@@ -204,63 +667,308 @@ func (s *Shell) newBuiltinRunner(
 		start: func() error {
 			go func() {
 				result := builtin.Execute(ctx, args, command.IO{
-					Stdin:  setup.ioCtx.Stdin,
-					Stdout: setup.ioCtx.Stdout,
-					Stderr: setup.ioCtx.Stderr,
+					Stdin:  setup.ioCtx.Stdin(),
+					Stdout: setup.ioCtx.Stdout(),
+					Stderr: setup.ioCtx.Stderr(),
 				})
-				if result == command.Exit {
-					atomic.StoreInt32(exitFlag, 1)
-				}
 				s.closePipelineIO(setup)
 				done <- result
 			}()
 			return nil
 		},
-		wait: func() {
-			<-done
+		wait: func() command.Result {
+			return <-done
+		},
+	}
+}
+
+// newCompoundRunner runs a compound command's body with the stage's
+// descriptors as the table its own commands start from.
+func (s *Shell) newCompoundRunner(ctx context.Context, body parser.Node, setup pipeSetup) runner {
+	done := make(chan command.Result, 1)
+
+	return runner{
+		start: func() error {
+			go func() {
+				status := s.executeCompound(ctx, body, setup.ioCtx)
+				s.closePipelineIO(setup)
+				done <- status
+			}()
+			return nil
+		},
+		wait: func() command.Result {
+			return <-done
 		},
 	}
 }
 
+// newExternalRunner runs a program. It is not tied to the command line's
+// context: a program gets SIGINT from the terminal, or from the shell, and
+// one stopped and continued in the background outlives the command line.
 func (s *Shell) newExternalRunner(
-	ctx context.Context,
 	path string,
 	args []string,
 	name string,
 	setup pipeSetup,
 ) runner {
-	externalCmd := exec.CommandContext(ctx, path, args...)
+	externalCmd := exec.Command(path, args...)
 	externalCmd.Args[0] = name
-	externalCmd.Stdin = setup.ioCtx.Stdin
-	externalCmd.Stdout = setup.ioCtx.Stdout
-	externalCmd.Stderr = setup.ioCtx.Stderr
+	externalCmd.Env = s.environ()
+	externalCmd.Dir = s.dir
+	externalCmd.Stdin = setup.ioCtx.Stdin()
+	externalCmd.Stdout = setup.ioCtx.Stdout()
+	externalCmd.Stderr = setup.ioCtx.Stderr()
+	externalCmd.ExtraFiles = setup.ioCtx.ExtraFiles()
+
+	var startErr error
+	j := s.job
 
 	return runner{
 		start: func() error {
-			return externalCmd.Start()
+			if j != nil {
+				startErr = j.start(externalCmd)
+			} else {
+				startErr = externalCmd.Start()
+			}
+			// a program that cannot start fails as its own stage, like one
+			// that was not found
+			if startErr != nil {
+				fmt.Fprintf(externalCmd.Stderr, "%s: %v\n", name, startErr)
+			}
+			setup = releaseFiles(setup)
+			if startErr == nil && setup.closeStdin != nil {
+				// the stages are waited for in order, so the in-memory
+				// pipe it reads from is closed as soon as it exits, for
+				// the stage writing to it to stop
+				closeOnExit(externalCmd.Process.Pid, setup.closeStdin)
+			}
+			return nil
 		},
-		wait: func() {
-			_ = externalCmd.Wait()
+		wait: func() command.Result {
+			if startErr != nil {
+				s.closePipelineIO(setup)
+				return command.NotExecutable
+			}
+			if j != nil {
+				j.watch(externalCmd.Process.Pid)
+			}
+			externalCmd.Wait()
 			s.closePipelineIO(setup)
+			return exitStatus(externalCmd.ProcessState)
 		},
 	}
 }
 
+// closeOnExit closes c once the process pid has exited, without reaping
+// it; that is left to exec.Cmd.Wait.
+func closeOnExit(pid int, c io.Closer) {
+	go func() {
+		var info unix.Siginfo
+		for unix.Waitid(unix.P_PID, pid, &info, unix.WEXITED|unix.WNOWAIT, nil) == unix.EINTR {
+		}
+		c.Close()
+	}()
+}
+
+// newFinishedRunner stands in for a stage with nothing left to run, such as
+// a command that could not be found: it reports msg, if any, and ends with
+// status without stopping the rest of the pipeline.
+func (s *Shell) newFinishedRunner(status command.Result, msg string, setup pipeSetup) runner {
+	return runner{
+		// closing its end of the pipe right away lets the stage before it
+		// finish writing
+		start: func() error {
+			if msg != "" {
+				fmt.Fprintln(setup.ioCtx.Stderr(), msg)
+			}
+			s.closePipelineIO(setup)
+			return nil
+		},
+		wait: func() command.Result {
+			return status
+		},
+	}
+}
+
+// exitStatus turns how a process ended into a shell status: its exit code,
+// or 128 plus the signal that killed it.
+func exitStatus(state *os.ProcessState) command.Result {
+	if state == nil {
+		return command.Error
+	}
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return command.Result(128 + int(ws.Signal()))
+	}
+	return command.Result(state.ExitCode())
+}
+
+func (s *Shell) isExecRedirect(st stage) bool {
+	_, ok := s.commands["exec"]
+	return ok && st.name == "exec" && len(st.args) == 0
+}
+
+// Exec replaces the shell process with the command in args, the way the exec
+// builtin does. Its standard streams and the shell's numbered descriptors
+// become real descriptors of the new program.
+func (s *Shell) Exec(args []string, stdio command.IO) error {
+	path, ok := s.IsExecutable(args[0])
+	if !ok {
+		return fmt.Errorf("%s: not found", args[0])
+	}
+
+	files := s.fds.Files()
+	streams := []any{stdio.Stdin, stdio.Stdout, stdio.Stderr}
+	for fd, stream := range streams {
+		if f, ok := stream.(*os.File); ok {
+			files[fd] = f
+		}
+	}
+	for fd, f := range files {
+		if int(f.Fd()) == fd {
+			continue
+		}
+		if err := unix.Dup2(int(f.Fd()), fd); err != nil {
+			return err
+		}
+	}
+
+	// the new program runs in the shell's directory, which only now
+	// becomes the process's
+	if err := os.Chdir(s.dir); err != nil {
+		return err
+	}
+	return syscall.Exec(path, args, s.environ())
+}
+
 func (s *Shell) IsBuiltin(name string) bool {
 	_, ok := s.commands[name]
 	return ok
 }
 
+// IsExecutable finds the program name runs, searching the shell's $PATH
+// when name has no slash.
 func (s *Shell) IsExecutable(name string) (string, bool) {
-	path, err := exec.LookPath(name)
-	if err != nil {
-		return "", false
+	if strings.Contains(name, "/") {
+		return name, isExecutableFile(s.Path(name))
+	}
+	pathEnv, _ := s.LookupVar("PATH")
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			dir = "."
+		}
+		if path := dir + "/" + name; isExecutableFile(s.Path(path)) {
+			return path, true
+		}
 	}
-	return path, true
+	return "", false
 }
 
+func isExecutableFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// lookCommand finds the program to run for name. When there is none it
+// returns the status and message to fail with: 127 when nothing was found,
+// 126 when a file was found that cannot be executed.
+func (s *Shell) lookCommand(name string) (string, command.Result, string) {
+	if path, ok := s.IsExecutable(name); ok {
+		return path, command.Ok, ""
+	}
+	if !strings.Contains(name, "/") {
+		return "", command.NotFound, name + ": command not found"
+	}
+
+	info, err := os.Stat(s.Path(name))
+	switch {
+	case err != nil:
+		return "", command.NotFound, name + ": No such file or directory"
+	case info.IsDir():
+		return "", command.NotExecutable, name + ": Is a directory"
+	default:
+		return "", command.NotExecutable, name + ": Permission denied"
+	}
+}
+
+// Status is $?, for the exit builtin.
+func (s *Shell) Status() command.Result {
+	return s.status
+}
+
+// SetOption turns a set -o option on or off.
+func (s *Shell) SetOption(name string, on bool) error {
+	if _, ok := s.options[name]; !ok {
+		return fmt.Errorf("%s: invalid option name", name)
+	}
+	s.options[name] = on
+	return nil
+}
+
+func (s *Shell) Options() map[string]bool {
+	options := make(map[string]bool, len(s.options))
+	for name, on := range s.options {
+		options[name] = on
+	}
+	return options
+}
+
+// Exit makes the shell stop with status once the current command is done.
+func (s *Shell) Exit(status command.Result) {
+	s.status = status
+	s.exiting = true
+}
+
+// ChangeDir makes path, relative to the working directory, the new one.
+// Like cd in bash it goes by the path as written, so .. leaves a symbolic
+// link the way it was entered.
 func (s *Shell) ChangeDir(path string) error {
-	return os.Chdir(path)
+	dir := s.Path(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: "chdir", Path: path, Err: syscall.ENOTDIR}
+	}
+	if err := unix.Access(dir, unix.X_OK); err != nil {
+		return &fs.PathError{Op: "chdir", Path: path, Err: err}
+	}
+	oldDir := s.dir
+	s.dir = dir
+
+	// keep ~+ and ~- in step with the directory
+	s.SetVar("OLDPWD", oldDir)
+	s.SetVar("PWD", dir)
+	return nil
+}
+
+// Dir returns the working directory, for pwd.
+func (s *Shell) Dir() string {
+	return s.dir
+}
+
+// Path resolves name against the working directory, for the shell and the
+// builtins that open files.
+func (s *Shell) Path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(s.dir, name)
+}
+
+// startDir is the directory the process started in, by the name $PWD gives
+// it when that is the same place.
+func startDir() string {
+	dir, _ := os.Getwd()
+	pwd := os.Getenv("PWD")
+	if filepath.IsAbs(pwd) {
+		a, errA := os.Stat(pwd)
+		b, errB := os.Stat(dir)
+		if errA == nil && errB == nil && os.SameFile(a, b) {
+			return filepath.Clean(pwd)
+		}
+	}
+	return dir
 }
 
 func (s *Shell) builtinNames() []string {
@@ -275,7 +983,7 @@ func (s *Shell) executablesInPath() []string {
 	seen := make(map[string]struct{})
 	result := []string{}
 
-	pathEnv := os.Getenv("PATH")
+	pathEnv, _ := s.LookupVar("PATH")
 	dirs := filepath.SplitList(pathEnv)
 
 	for _, dir := range dirs {
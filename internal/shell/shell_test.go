@@ -0,0 +1,273 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/command"
+	"github.com/codecrafters-io/shell-starter-go/internal/lexer"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	shellruntime "github.com/codecrafters-io/shell-starter-go/internal/runtime"
+)
+
+// testBuiltins is the part of the shell's builtins that scripts in the
+// tests below use.
+func testBuiltins(sh *Shell) map[string]command.Command {
+	return map[string]command.Command{
+		"echo":     command.EchoCommand{},
+		"exit":     command.NewExitCommand(sh.Status, sh.Exit),
+		"set":      command.NewSetCommand(sh.SetOption, sh.Options),
+		"break":    command.NewBreakCommand(sh.Break),
+		"continue": command.NewContinueCommand(sh.Continue),
+		"return":   command.NewReturnCommand(sh.Status, sh.Return),
+		"local":    command.NewLocalCommand(sh.Local, sh.SetVar),
+		"export":   command.NewExportCommand(sh.SetVar, sh.Export, sh.Variables),
+		"unset":    command.NewUnsetCommand(sh.UnsetVar, sh.UnsetFunction),
+		"kill":     command.NewKillCommand(sh.LookupJob, sh.QueueSignal),
+		"wait":     command.NewWaitCommand(sh.LookupJob, sh.Jobs, sh.WaitJob),
+		"read":     command.NewReadCommand(sh.LookupVar, sh.SetVar),
+		"trap":     command.NewTrapCommand(sh.SetTrap, sh.Traps),
+	}
+}
+
+// run runs script in a new shell and returns what it wrote to stdout.
+func run(t *testing.T, script string) string {
+	t.Helper()
+	tokens, err := lexer.Tokenize(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := parser.Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", script, err)
+	}
+
+	s := New(testBuiltins, nil)
+	s.dir = t.TempDir()
+	var out bytes.Buffer
+	fds := s.fds.Clone()
+	fds.Set(1, shellruntime.WriterFD(&out))
+	defer fds.Close()
+	s.executeList(context.Background(), list, fds)
+	return out.String()
+}
+
+func TestLists(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"echo a; echo b", "a\nb\n"},
+		{"echo a\necho b", "a\nb\n"},
+		{"true && echo yes", "yes\n"},
+		{"false && echo yes", ""},
+		{"false || echo no", "no\n"},
+		{"true || echo no; echo $?", "0\n"},
+		{"false && echo a || echo b", "b\n"},
+		{"false; echo $?", "1\n"},
+		{"exit 3; echo after", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			if got := run(t, tt.script); got != tt.want {
+				t.Errorf("%q printed %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCase(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"case abc in a*) echo a;; *) echo other;; esac", "a\n"},
+		{"case xyz in a*) echo a;; *) echo other;; esac", "other\n"},
+		{"case b in a|b) echo ab;; esac", "ab\n"},
+		{"v=c; case $v in \"$v\") echo same;; esac", "same\n"},
+		{"case '*' in \\*) echo star;; esac", "star\n"},
+		{"case a in a) echo 1;& b) echo 2;; c) echo 3;; esac", "1\n2\n"},
+		{"case a in a) echo 1;;& b) echo 2;; *) echo 3;; esac", "1\n3\n"},
+		{"case z in a) echo 1;; esac; echo $?", "0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			if got := run(t, tt.script); got != tt.want {
+				t.Errorf("%q printed %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"x=1 y=$x; echo $y", "1\n"},
+		{"x=1; x=2 y=$x; echo $x $y", "2 2\n"},
+		{"A=1 B=$A sh -c 'echo $A $B'", "1 1\n"},
+		{"f() { echo $A $B; }; A=1 B=$A f; echo -$A-$B-", "1 1\n---\n"},
+		{"x=old; x=new echo $x", "old\n"},
+		{"x=$(echo a b) y=\"$x\"; echo \"$y\"", "a b\n"},
+		{"x=1 y=$((x + 1)); echo $y", "2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			if got := run(t, tt.script); got != tt.want {
+				t.Errorf("%q printed %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoclobber(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"echo a > f; echo b > f; cat f", "b\n"},
+		{"set -o noclobber; echo a > f; cat f", "a\n"},
+		{"echo a > f; set -o noclobber; echo b > f; echo $?; cat f", "1\na\n"},
+		{"echo a > f; set -o noclobber; echo b &> f; cat f", "a\n"},
+		{"echo a > f; set -o noclobber; echo b >| f; cat f", "b\n"},
+		{"echo a > f; set -o noclobber; echo b >> f; cat f", "a\nb\n"},
+		{"set -o noclobber; echo a > /dev/null; echo $?", "0\n"},
+		{"echo a > f; set -o noclobber; set +o noclobber; echo b > f; cat f", "b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			if got := run(t, tt.script); got != tt.want {
+				t.Errorf("%q printed %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKillErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"kill %5 2>&1", "kill: %5: no such job\n"},
+		{"kill abc 2>&1", "kill: abc: arguments must be process or job IDs\n"},
+		{"kill 2>&1; echo $?", "kill: usage: kill [-s sigspec | -signum | -sigspec] pid | jobspec ... or kill -l\n1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			if got := run(t, tt.script); got != tt.want {
+				t.Errorf("%q printed %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEchoWriteErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"{ echo a | echo b; } 2>&1", "b\n"},
+		{"f() { echo $1; }; { f a | f b; } 2>&1", "b\n"},
+		{"echo a | echo b; echo ${PIPESTATUS[1]}", "b\n0\n"},
+		{"{ echo a >&-; } 2>&1 | cut -d: -f1-2; echo $?", "echo: write error\n0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			if got := run(t, tt.script); got != tt.want {
+				t.Errorf("%q printed %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBrokenPipe(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"while true; do echo y; done | head -1", "y\n"},
+		{"for i in {1..20000}; do echo $i; done | head -1", "1\n"},
+		{"f() { while true; do echo f; done; }; f | head -1", "f\n"},
+		{"{ while true; do echo g; done; } | head -1", "g\n"},
+		{"while true; do echo y; done | head -1; echo ${PIPESTATUS[@]}", "y\n141 0\n"},
+		{"while true; do echo y; done | head -1 | cat", "y\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			done := make(chan string, 1)
+			go func() { done <- run(t, tt.script) }()
+			select {
+			case got := <-done:
+				if got != tt.want {
+					t.Errorf("%q printed %q, want %q", tt.script, got, tt.want)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("%q did not finish", tt.script)
+			}
+		})
+	}
+}
+
+func TestBackgroundInShell(t *testing.T) {
+	// the job blocks opening the FIFO until the line goes on to write to it
+	fifo := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	script := "read l < " + fifo + " & echo started; echo x > " + fifo + "; wait; echo $?"
+
+	done := make(chan string, 1)
+	go func() { done <- run(t, script) }()
+	select {
+	case got := <-done:
+		if want := "started\n0\n"; got != want {
+			t.Errorf("%q printed %q, want %q", script, got, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%q did not finish", script)
+	}
+}
+
+func TestErrorsGoToStderr(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"{ cat <nosuch; } 2>/dev/null; echo $?", "1\n"},
+		{"x=$( { cat <nosuch; } 2>&1 ); echo \"$x\"", "nosuch: No such file or directory\n"},
+		{"f() { echo $((1/0)); }; f 2>/dev/null; echo $?", "1\n"},
+		{"{ echo $((1/0)); } 2>&1 | wc -l | tr -d ' '", "1\n"},
+		{"{ echo a >/nosuch/f; } 2>&1", "/nosuch/f: No such file or directory\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			if got := run(t, tt.script); got != tt.want {
+				t.Errorf("%q printed %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKillOwnShell(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"trap 'echo usr' USR1; kill -USR1 $$; echo after", "usr\nafter\n"},
+		{"trap 'echo term' TERM; kill $$; echo after", "term\nafter\n"},
+		{"trap 'echo usr' USR1; kill -USR1 $$ && echo ok", "usr\nok\n"},
+		{"trap 'echo usr' USR1; for i in 1 2; do kill -USR1 $$; echo $i; done", "usr\n1\nusr\n2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			if got := run(t, tt.script); got != tt.want {
+				t.Errorf("%q printed %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
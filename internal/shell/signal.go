@@ -0,0 +1,199 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/term"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/command"
+)
+
+/* =========================
+         SIGNALS
+========================= */
+
+// caught are the signals the shell catches itself. Catching SIGINT and
+// SIGQUIT, rather than ignoring them, leaves them at their defaults in the
+// programs the shell starts.
+var caught = []os.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGTSTP}
+
+// handleSignals takes over the signals meant for the shell. SIGINT and
+// SIGQUIT go on to the foreground job, and SIGINT also interrupts the
+// command line that is running. SIGTERM and SIGHUP end the shell. A signal
+// with a trap runs it instead: between commands, or at once at the prompt.
+func (s *Shell) handleSignals() (stop func()) {
+	s.sigs = make(chan os.Signal, 1)
+	signal.Notify(s.sigs, caught...)
+
+	go func() {
+		for sig := range s.sigs {
+			sig := sig.(syscall.Signal)
+			_, trapped := s.trapAction(trapName(sig))
+			switch sig {
+			case syscall.SIGINT, syscall.SIGQUIT:
+				j := s.foreground.Load()
+				if j != nil {
+					j.signal(sig)
+				}
+				if trapped {
+					s.deliver(sig)
+				} else if sig == syscall.SIGINT && s.interrupt() && j == nil {
+					// the shell took the ^C itself; move past it
+					fmt.Println()
+				}
+			case syscall.SIGTERM, syscall.SIGHUP:
+				if trapped {
+					s.deliver(sig)
+				} else {
+					s.shutdown(sig)
+				}
+			default:
+				if trapped {
+					s.deliver(sig)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(s.sigs)
+		close(s.sigs)
+	}
+}
+
+// deliver queues the trap for sig. A command line running runs it after
+// its current command; at the prompt it runs at once, and the prompt is
+// drawn again after it.
+func (s *Shell) deliver(sig syscall.Signal) {
+	s.queueSignal(sig)
+	if !s.busy.TryLock() {
+		return
+	}
+	defer s.busy.Unlock()
+
+	run := func() {
+		s.runTraps(context.Background(), s.fds)
+		if s.exiting {
+			s.runExitHooks()
+			os.Exit(int(s.status))
+		}
+	}
+	if s.lineEditor != nil {
+		s.lineEditor.Suspend(run)
+	} else {
+		run()
+	}
+}
+
+// runLine runs a command line with a context of its own, which SIGINT
+// cancels. An interrupted line leaves status 130, as if its last command had
+// died of SIGINT.
+func (s *Shell) runLine(run func(ctx context.Context)) {
+	s.busy.Lock()
+	defer s.busy.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.mu.Lock()
+	s.interrupted.Store(false)
+	s.cancel = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.cancel = nil
+		s.mu.Unlock()
+	}()
+
+	// traps for signals that came at the prompt run first
+	s.runTraps(ctx, s.fds)
+	run(ctx)
+	if s.interrupted.Load() {
+		s.status = command.Result(128 + int(syscall.SIGINT))
+	}
+}
+
+// interrupt stops the command line that is running, if any, the way SIGINT
+// does: lists and loops give up, and its context is cancelled. It reports
+// whether there was a line to stop.
+func (s *Shell) interrupt() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel == nil {
+		// at the prompt SIGINT has nothing to stop
+		return false
+	}
+	s.interrupted.Store(true)
+	s.cancel()
+	return true
+}
+
+// interruptedBy reports whether a foreground job ending with statuses was
+// killed from the terminal by SIGINT, which the shell, having handed the
+// job the terminal, did not get itself. The job's command line stops as if
+// it had, or runs the SIGINT trap.
+func (s *Shell) interruptedBy(statuses []command.Result) bool {
+	for _, status := range statuses {
+		if status == command.Result(128+int(syscall.SIGINT)) {
+			if _, trapped := s.trapAction(trapName(syscall.SIGINT)); trapped {
+				s.queueSignal(syscall.SIGINT)
+			} else {
+				s.interrupt()
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// OnExit registers fn to run when the shell ends, whether through exit, the
+// end of input or a signal. The EXIT trap runs before it.
+func (s *Shell) OnExit(fn func()) {
+	s.exitHooks = append(s.exitHooks, fn)
+}
+
+func (s *Shell) runExitHooks() {
+	s.exitOnce.Do(func() {
+		s.trapExit()
+		for _, fn := range s.exitHooks {
+			fn()
+		}
+	})
+}
+
+// shutdown ends the shell on SIGTERM or SIGHUP. At the prompt it does so
+// at once; a command line running is interrupted, its foreground job is
+// sent the signal, and the shell ends once the line has stopped.
+func (s *Shell) shutdown(sig syscall.Signal) {
+	if !s.busy.TryLock() {
+		// the foreground job gets the signal too, or the shell would wait
+		// for it to end of its own accord
+		if j := s.foreground.Load(); j != nil {
+			j.signal(sig)
+		}
+		s.queueSignal(sig)
+		s.interrupt()
+		return
+	}
+	s.exitOn(sig)
+}
+
+// exitOn ends the shell as the signal sig would. A hangup means the
+// terminal is gone, so the jobs that ran on it get SIGHUP as well.
+func (s *Shell) exitOn(sig syscall.Signal) {
+	if sig == syscall.SIGHUP {
+		jobs, _ := s.jobs.list()
+		for _, j := range jobs {
+			j.signal(syscall.SIGHUP)
+			j.signal(syscall.SIGCONT)
+		}
+	}
+	if s.modes != nil {
+		term.Restore(s.tty, s.modes)
+	}
+	s.runExitHooks()
+	os.Exit(128 + int(sig))
+}
@@ -0,0 +1,62 @@
+package shell
+
+import (
+	"context"
+	"maps"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/command"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	shellruntime "github.com/codecrafters-io/shell-starter-go/internal/runtime"
+)
+
+/* =========================
+        SUBSHELLS
+========================= */
+
+// subshell copies the shell for ( list ), a command substitution or a stage
+// of a pipeline, so that nothing run there can change this shell. fds
+// becomes the copy's descriptor table. end must be called once the copy is
+// done with; it runs the copy's EXIT trap.
+func (s *Shell) subshell(fds *shellruntime.IOContext) (sub *Shell, end func()) {
+	frames := make([]*frame, len(s.frames))
+	for i, f := range s.frames {
+		frames[i] = &frame{args: f.args, saved: cloneVars(f.saved)}
+	}
+
+	sub = &Shell{
+		builtins:   s.builtins,
+		functions:  maps.Clone(s.functions),
+		vars:       cloneVars(s.vars),
+		frames:     frames,
+		history:    s.history,
+		dir:        s.dir,
+		fds:        fds,
+		status:     s.status,
+		pipeStatus: s.pipeStatus,
+		options:    maps.Clone(s.options),
+		loops:      s.loops,
+		// a subshell has no job control; its processes join the job it
+		// runs in
+		jobs:           s.jobs,
+		job:            s.job,
+		tty:            -1,
+		pgid:           s.pgid,
+		lastBackground: s.lastBackground,
+		interrupted:    s.interrupted,
+		brokenPipe:     s.brokenPipe,
+		// the traps themselves do not carry over, only ignored signals
+		traps: s.ignoredTraps(),
+	}
+	sub.commands = s.builtins(sub)
+	return sub, sub.trapExit
+}
+
+func (s *Shell) executeSubshell(ctx context.Context, subshell *parser.Subshell, fds *shellruntime.IOContext) command.Result {
+	fds = fds.Clone()
+	defer fds.Close()
+
+	sub, end := s.subshell(fds)
+	defer end()
+	sub.executeList(ctx, subshell.Body, fds)
+	return sub.status
+}
@@ -0,0 +1,240 @@
+package shell
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/command"
+	"github.com/codecrafters-io/shell-starter-go/internal/lexer"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	shellruntime "github.com/codecrafters-io/shell-starter-go/internal/runtime"
+)
+
+/* =========================
+          TRAPS
+========================= */
+
+// SetTrap backs the trap builtin: action runs when the signal name, such as
+// SIGINT or EXIT, arrives. An empty action ignores the signal and "-" puts
+// back the default.
+func (s *Shell) SetTrap(name, action string) {
+	s.mu.Lock()
+	if action == "-" {
+		delete(s.traps, name)
+	} else {
+		s.traps[name] = action
+	}
+	s.mu.Unlock()
+
+	// a subshell shares the process with its parent, so only the shell
+	// itself changes how signals are handled
+	if sig, ok := command.ParseSignal(name); ok && s.sigs != nil {
+		switch {
+		case action == "":
+			signal.Ignore(sig)
+		case action != "-" || slices.Contains(caught, os.Signal(sig)):
+			signal.Notify(s.sigs, sig)
+		default:
+			signal.Reset(sig)
+		}
+	}
+}
+
+// Traps returns the traps set, EXIT first and the signals in number order,
+// for trap -p.
+func (s *Shell) Traps() []command.Trap {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	traps := make([]command.Trap, 0, len(s.traps))
+	for name, action := range s.traps {
+		traps = append(traps, command.Trap{Name: name, Action: action})
+	}
+	slices.SortFunc(traps, func(a, b command.Trap) int {
+		return cmp.Compare(trapOrder(a.Name), trapOrder(b.Name))
+	})
+	return traps
+}
+
+// trapOrder places the pseudo-signals other than EXIT after the signals.
+func trapOrder(name string) int {
+	switch name {
+	case "EXIT":
+		return 0
+	case "DEBUG":
+		return 100
+	case "ERR":
+		return 101
+	case "RETURN":
+		return 102
+	}
+	sig, _ := command.ParseSignal(name)
+	return int(sig)
+}
+
+// trapAction returns the commands trapped on name, unless there are none or
+// the signal is ignored.
+func (s *Shell) trapAction(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	action := s.traps[name]
+	return action, action != ""
+}
+
+func trapName(sig syscall.Signal) string {
+	return "SIG" + command.SignalName(sig)
+}
+
+// ignoredTraps returns the signals ignored, which is all a subshell keeps
+// of the traps.
+func (s *Shell) ignoredTraps() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	traps := make(map[string]string)
+	for name, action := range s.traps {
+		if action == "" {
+			traps[name] = ""
+		}
+	}
+	return traps
+}
+
+// hideTrap takes away the trap on name and returns a func that puts it
+// back.
+func (s *Shell) hideTrap(name string) (restore func()) {
+	s.mu.Lock()
+	action, ok := s.traps[name]
+	delete(s.traps, name)
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if ok {
+			s.traps[name] = action
+		} else {
+			delete(s.traps, name)
+		}
+	}
+}
+
+// runTrap runs the commands of a trap. They leave $? as it was, unless they
+// exit the shell.
+func (s *Shell) runTrap(ctx context.Context, action string, fds *shellruntime.IOContext) {
+	tokens, err := lexer.Tokenize(action)
+	if err != nil {
+		fmt.Fprintln(fds.Stderr(), err)
+		return
+	}
+	list, err := parser.Parse(tokens)
+	if err != nil {
+		fmt.Fprintln(fds.Stderr(), err)
+		return
+	}
+
+	status, flow, exiting, inTrap := s.status, s.flow, s.exiting, s.inTrap
+	interrupted := s.interrupted.Swap(false)
+	s.flow, s.exiting, s.inTrap = flowNext, false, true
+	s.executeList(ctx, list, fds)
+	s.inTrap = inTrap
+	if interrupted {
+		s.interrupted.Store(true)
+	}
+	if s.exiting {
+		return
+	}
+	s.status, s.flow, s.exiting = status, flow, exiting
+}
+
+// QueueSignal backs kill with the shell's own process ID: when sig has a
+// trap, the trap is queued to run before the next command, as if the
+// signal had arrived at once, and QueueSignal reports true.
+func (s *Shell) QueueSignal(sig syscall.Signal) bool {
+	if _, trapped := s.trapAction(trapName(sig)); !trapped {
+		return false
+	}
+	s.queueSignal(sig)
+	return true
+}
+
+// queueSignal notes that sig arrived, for its trap to run between
+// commands.
+func (s *Shell) queueSignal(sig syscall.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, sig)
+}
+
+// runTraps runs the traps for the signals that arrived since the last
+// command. A SIGTERM or SIGHUP with no trap left ends the shell.
+func (s *Shell) runTraps(ctx context.Context, fds *shellruntime.IOContext) {
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		sig := s.pending[0]
+		s.pending = s.pending[1:]
+		action, ok := s.traps[trapName(sig)]
+		s.mu.Unlock()
+
+		switch {
+		case ok && action != "":
+			s.runTrap(ctx, action, fds)
+		case !ok && (sig == syscall.SIGTERM || sig == syscall.SIGHUP):
+			s.exitOn(sig)
+		}
+	}
+}
+
+// trapExit runs the EXIT trap as the shell or a subshell ends.
+func (s *Shell) trapExit() {
+	action, ok := s.trapAction("EXIT")
+	if !ok {
+		return
+	}
+	s.SetTrap("EXIT", "-")
+	s.runTrap(context.Background(), action, s.fds)
+}
+
+// trapError runs the ERR trap after pipeline failed, unless the failure was
+// being tested, as in an if condition. Like bash without set -E, functions
+// do not inherit the trap; the call that failed runs it instead. A compound
+// command other than a subshell ran the trap already for the command in it
+// that failed.
+func (s *Shell) trapError(ctx context.Context, pipeline *parser.Pipeline, fds *shellruntime.IOContext) {
+	if s.inTrap || s.conditions > 0 || len(s.frames) > 0 {
+		return
+	}
+	if len(pipeline.Commands) == 1 {
+		if cmd, ok := pipeline.Commands[0].(*parser.CompoundCommand); ok {
+			if _, ok := cmd.Body.(*parser.Subshell); !ok {
+				return
+			}
+		}
+	}
+	if action, ok := s.trapAction("ERR"); ok {
+		s.runTrap(ctx, action, fds)
+	}
+}
+
+// trapDebug runs the DEBUG trap before a pipeline of simple commands, with
+// BASH_COMMAND set to the pipeline's text.
+func (s *Shell) trapDebug(ctx context.Context, pipeline []parser.Command, fds *shellruntime.IOContext) {
+	if s.inTrap {
+		return
+	}
+	action, ok := s.trapAction("DEBUG")
+	if !ok {
+		return
+	}
+	if _, simple := pipeline[0].(*parser.CommandLine); len(pipeline) == 1 && !simple {
+		return
+	}
+	s.SetVar("BASH_COMMAND", (&parser.Pipeline{Commands: pipeline}).String())
+	s.runTrap(ctx, action, fds)
+}
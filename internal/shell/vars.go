@@ -0,0 +1,270 @@
+package shell
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/command"
+	"github.com/codecrafters-io/shell-starter-go/internal/lexer"
+)
+
+/* =========================
+        VARIABLES
+========================= */
+
+// variable is a shell variable. Only exported ones reach the environment of
+// the programs the shell runs.
+type variable struct {
+	value    string
+	exported bool
+	readonly bool
+	// valueless is set for a name given attributes, as by export NAME,
+	// but no value yet; it reads as unset.
+	valueless bool
+}
+
+func errReadonly(name string) error {
+	return fmt.Errorf("%s: readonly variable", name)
+}
+
+func checkName(name string) error {
+	if !lexer.IsName(name) {
+		return fmt.Errorf("`%s': not a valid identifier", name)
+	}
+	return nil
+}
+
+// environVars makes the variable table a shell starts with: the process
+// environment, all of it exported.
+func environVars() map[string]*variable {
+	vars := make(map[string]*variable)
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		vars[name] = &variable{value: value, exported: true}
+	}
+	return vars
+}
+
+// cloneVars copies a variable table for a subshell. A nil variable, which a
+// frame keeps for one that was unset, stays nil.
+func cloneVars(vars map[string]*variable) map[string]*variable {
+	clone := make(map[string]*variable, len(vars))
+	for name, v := range vars {
+		if v == nil {
+			clone[name] = nil
+			continue
+		}
+		copied := *v
+		clone[name] = &copied
+	}
+	return clone
+}
+
+// environ lists the exported variables as NAME=value, for exec.Cmd.Env.
+func (s *Shell) environ() []string {
+	env := make([]string, 0, len(s.vars))
+	for _, name := range slices.Sorted(maps.Keys(s.vars)) {
+		if v := s.vars[name]; v.exported && !v.valueless {
+			env = append(env, name+"="+v.value)
+		}
+	}
+	return env
+}
+
+// assign expands NAME=value assignments and performs them on shell
+// variables, each before the next is expanded, so that x=1 y=$x sets y to 1.
+// It stops at the first one that fails, such as one to a readonly variable.
+func (s *Shell) assign(expander *lexer.Expander, assigns []lexer.Token) error {
+	for _, word := range assigns {
+		kv, err := expander.ExpandWord(word)
+		if err != nil {
+			return err
+		}
+		name, value, _ := strings.Cut(kv, "=")
+		if err := s.SetVar(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignTemp performs the assignments in front of a command name, exporting
+// the variables, and returns a func that puts them back as they were once
+// the command is done. Like assign, it expands each after the ones before
+// it are made. If any of them is readonly, none is made.
+func (s *Shell) assignTemp(expander *lexer.Expander, assigns []lexer.Token) (restore func(), err error) {
+	for _, word := range assigns {
+		name, _, _ := strings.Cut(word.Value, "=")
+		if v, ok := s.vars[name]; ok && v.readonly {
+			return nil, errReadonly(name)
+		}
+	}
+
+	saved := make(map[string]*variable, len(assigns))
+	restore = func() {
+		for name, v := range saved {
+			if v == nil {
+				delete(s.vars, name)
+			} else {
+				s.vars[name] = v
+			}
+		}
+	}
+	for _, word := range assigns {
+		kv, err := expander.ExpandWord(word)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		name, value, _ := strings.Cut(kv, "=")
+		if _, ok := saved[name]; !ok {
+			saved[name] = s.vars[name]
+		}
+		s.vars[name] = &variable{value: value, exported: true}
+	}
+	return restore, nil
+}
+
+// LookupVar and SetVar give word expansion access to the shell variables.
+func (s *Shell) LookupVar(name string) (string, bool) {
+	switch name {
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "?":
+		return strconv.Itoa(int(s.status)), true
+	case "!":
+		if s.lastBackground == nil {
+			return "", false
+		}
+		pid := s.lastBackground.lastPid()
+		if pid == 0 {
+			return "", false
+		}
+		return strconv.Itoa(pid), true
+	case "#":
+		return strconv.Itoa(len(s.positional())), true
+	case "@", "*":
+		return strings.Join(s.positional(), " "), true
+	}
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		args := s.positional()
+		if n > len(args) {
+			return "", false
+		}
+		return args[n-1], true
+	}
+	if elems, ok := s.LookupArray(name); ok {
+		// an array read as a plain variable is its first element
+		if len(elems) == 0 {
+			return "", false
+		}
+		return elems[0], true
+	}
+	if v, ok := s.vars[name]; ok && !v.valueless {
+		return v.value, true
+	}
+	return "", false
+}
+
+func (s *Shell) LookupArray(name string) ([]string, bool) {
+	if name == "@" {
+		return s.positional(), true
+	}
+	if name != "PIPESTATUS" {
+		return nil, false
+	}
+	elems := make([]string, len(s.pipeStatus))
+	for i, status := range s.pipeStatus {
+		elems[i] = strconv.Itoa(int(status))
+	}
+	return elems, true
+}
+
+// SetVar sets a shell variable. A variable that was exported stays exported.
+func (s *Shell) SetVar(name, value string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	v, ok := s.vars[name]
+	if !ok {
+		s.vars[name] = &variable{value: value}
+		return nil
+	}
+	if v.readonly {
+		return errReadonly(name)
+	}
+	v.value, v.valueless = value, false
+	return nil
+}
+
+func (s *Shell) UnsetVar(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if v, ok := s.vars[name]; ok && v.readonly {
+		return fmt.Errorf("%s: cannot unset: readonly variable", name)
+	}
+	delete(s.vars, name)
+	return nil
+}
+
+// UnsetFunction removes the function name, for unset -f.
+func (s *Shell) UnsetFunction(name string) error {
+	delete(s.functions, name)
+	return nil
+}
+
+// Export gives name the export attribute, or with on false takes it away,
+// for export and declare -x.
+func (s *Shell) Export(name string, on bool) error {
+	v, err := s.declare(name)
+	if err != nil {
+		return err
+	}
+	v.exported = on
+	return nil
+}
+
+// Readonly makes name readonly, for readonly and declare -r.
+func (s *Shell) Readonly(name string) error {
+	v, err := s.declare(name)
+	if err != nil {
+		return err
+	}
+	v.readonly = true
+	return nil
+}
+
+// declare returns the variable name, making a valueless one when it is not
+// set.
+func (s *Shell) declare(name string) (*variable, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	v, ok := s.vars[name]
+	if !ok {
+		v = &variable{valueless: true}
+		s.vars[name] = v
+	}
+	return v, nil
+}
+
+// Variables lists the shell variables by name, for declare -p.
+func (s *Shell) Variables() []command.Variable {
+	vars := make([]command.Variable, 0, len(s.vars))
+	for _, name := range slices.Sorted(maps.Keys(s.vars)) {
+		v := s.vars[name]
+		vars = append(vars, command.Variable{
+			Name:     name,
+			Value:    v.value,
+			Set:      !v.valueless,
+			Exported: v.exported,
+			Readonly: v.readonly,
+		})
+	}
+	return vars
+}